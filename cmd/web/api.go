@@ -0,0 +1,480 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/justinas/nosurf"
+	"github.com/mgxnch/snippetbox/internal/models"
+	"github.com/mgxnch/snippetbox/internal/validator"
+)
+
+// maxJSONBytes is the largest request body that readJSON accepts.
+const maxJSONBytes = 1_048_576
+
+// envelope wraps the top-level value of a JSON response body,
+// e.g. {"snippet": {...}}.
+type envelope map[string]any
+
+// apiError is the JSON body of every error response from the API.
+type apiError struct {
+	Error          string            `json:"error"`
+	FieldErrors    map[string]string `json:"field_errors,omitempty"`
+	NonFieldErrors []string          `json:"non_field_errors,omitempty"`
+}
+
+// snippetResponse is the JSON representation of a models.Snippet.
+type snippetResponse struct {
+	PublicID         string    `json:"public_id"`
+	UserID           int       `json:"user_id"`
+	Author           string    `json:"author"`
+	Title            string    `json:"title"`
+	Content          string    `json:"content"`
+	Format           string    `json:"format"`
+	Language         string    `json:"language"`
+	Visibility       string    `json:"visibility"`
+	Slug             string    `json:"slug,omitempty"` // only unlisted snippets have one
+	BurnAfterReading bool      `json:"burn_after_reading"`
+	Protected        bool      `json:"password_protected"`
+	Tags             []string  `json:"tags"`
+	Created          time.Time `json:"created"`
+	Expires          time.Time `json:"expires"`
+}
+
+// newSnippetResponse converts a models.Snippet into its JSON representation.
+func newSnippetResponse(s *models.Snippet) snippetResponse {
+	// Always return an array, even when there are no tags
+	tags := s.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	return snippetResponse{
+		PublicID:         s.PublicID,
+		UserID:           s.UserID,
+		Author:           s.Author,
+		Title:            s.Title,
+		Content:          s.Content,
+		Format:           s.Format,
+		Language:         s.Language,
+		Visibility:       s.Visibility,
+		Slug:             s.Slug,
+		BurnAfterReading: s.BurnAfterReading,
+		Protected:        s.Protected(),
+		Tags:             tags,
+		Created:          s.Created,
+		Expires:          s.Expires,
+	}
+}
+
+// newSnippetListResponse is like newSnippetResponse, but leaves out the
+// content of password-protected snippets that the user hasn't unlocked. Only
+// apiSnippetGet accepts their password.
+func (app *application) newSnippetListResponse(r *http.Request, s *models.Snippet) snippetResponse {
+	resp := newSnippetResponse(s)
+	if !app.unlocked(r, s) {
+		resp.Content = ""
+	}
+	return resp
+}
+
+// apiSnippetList returns the latest snippets.
+func (app *application) apiSnippetList(w http.ResponseWriter, r *http.Request) {
+	snippets, err := app.snippets.Latest()
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	// Always return an array, even when there are no snippets
+	resp := make([]snippetResponse, 0, len(snippets))
+	for _, s := range snippets {
+		resp = append(resp, app.newSnippetListResponse(r, s))
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"snippets": resp})
+}
+
+// searchMetadata describes a page of search results in the JSON API.
+type searchMetadata struct {
+	Query    string `json:"query"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"page_size"`
+	LastPage int    `json:"last_page"`
+	Total    int    `json:"total"`
+}
+
+// apiSearch returns the page of snippets matching the q query string parameter
+// given by the page parameter.
+func (app *application) apiSearch(w http.ResponseWriter, r *http.Request) {
+	var v validator.Validator
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	v.CheckField(validator.NotBlank(query), "q", "This field cannot be blank")
+
+	page, err := queryInt(r, "page", 1)
+	v.CheckField(err == nil && page >= 1, "page", "This field must be a positive integer")
+
+	if !v.Valid() {
+		app.apiValidationError(w, v)
+		return
+	}
+
+	results, err := app.snippets.Search(query, app.authenticatedUserID(r), page)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	resp := make([]snippetResponse, 0, len(results.Snippets))
+	for _, s := range results.Snippets {
+		resp = append(resp, app.newSnippetListResponse(r, s))
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{
+		"snippets": resp,
+		"metadata": searchMetadata{
+			Query:    results.Query,
+			Page:     results.Page,
+			PageSize: models.SearchPageSize,
+			LastPage: results.LastPage(),
+			Total:    results.Total,
+		},
+	})
+}
+
+// apiSnippetGet returns the snippet referred to in the URL. The password of a
+// password-protected snippet is sent in the X-Snippet-Password header, unless
+// the snippet was unlocked in the session. Burn-after-reading snippets are
+// burned by the first request, without the confirmation step of the HTML
+// page, which only guards against bots following links.
+func (app *application) apiSnippetGet(w http.ResponseWriter, r *http.Request) {
+	snippet, err := app.snippetFromURL(r)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiNotFound(w)
+		} else {
+			app.apiServerError(w, err)
+		}
+		return
+	}
+
+	if snippet.Burned {
+		app.apiGone(w)
+		return
+	}
+
+	if !app.unlocked(r, snippet) {
+		password := r.Header.Get("X-Snippet-Password")
+		if password == "" {
+			app.apiClientError(w, http.StatusForbidden, "the snippet is protected by a password, which must be sent in the X-Snippet-Password header")
+			return
+		}
+
+		wait, err := app.checkSnippetPassword(r, snippet, password)
+		if err != nil {
+			switch {
+			case errors.Is(err, errTooManyGuesses):
+				setRetryAfter(w, wait)
+				app.apiClientError(w, http.StatusTooManyRequests, "too many incorrect passwords, please try again later")
+			case errors.Is(err, models.ErrInvalidCredentials):
+				app.apiClientError(w, http.StatusForbidden, "the snippet password is incorrect")
+			default:
+				app.apiServerError(w, err)
+			}
+			return
+		}
+	}
+
+	if snippet.Protected() {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+
+	if snippet.BurnAfterReading {
+		// Only one of several concurrent requests gets the snippet back
+		snippet, err = app.snippets.Burn(snippet.ID)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.apiGone(w)
+			} else {
+				app.apiServerError(w, err)
+			}
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"snippet": newSnippetResponse(snippet)})
+}
+
+// apiSnippetCreate creates a snippet from a JSON body with the same fields
+// as snippetCreateForm.
+func (app *application) apiSnippetCreate(w http.ResponseWriter, r *http.Request) {
+	var form snippetCreateForm
+
+	err := app.readJSON(w, r, &form)
+	if err != nil {
+		app.apiClientError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	form.validate()
+	if !form.Valid() {
+		app.apiValidationError(w, form.Validator)
+		return
+	}
+
+	in, err := app.snippetInput(&form, nil)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+
+	id, err := app.snippets.Insert(userID, in)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	snippet, err := app.snippets.Get(id, userID)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/v1/snippets/"+snippet.Ref())
+	app.writeJSON(w, http.StatusCreated, envelope{"snippet": newSnippetResponse(snippet)})
+}
+
+// apiSnippetUpdate publishes a new revision of a snippet owned by the user.
+func (app *application) apiSnippetUpdate(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.apiOwnedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	var form snippetCreateForm
+
+	err := app.readJSON(w, r, &form)
+	if err != nil {
+		app.apiClientError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	form.validate()
+	if !form.Valid() {
+		app.apiValidationError(w, form.Validator)
+		return
+	}
+
+	in, err := app.snippetInput(&form, snippet)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+
+	err = app.snippets.Update(snippet.ID, userID, in)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	snippet, err = app.snippets.Get(snippet.ID, userID)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"snippet": newSnippetResponse(snippet)})
+}
+
+// apiSnippetDelete deletes a snippet owned by the user.
+func (app *application) apiSnippetDelete(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.apiOwnedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.snippets.Delete(snippet.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiNotFound(w)
+		} else {
+			app.apiServerError(w, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiOwnedSnippet is the JSON counterpart of ownedSnippet.
+func (app *application) apiOwnedSnippet(w http.ResponseWriter, r *http.Request) (snippet *models.Snippet, ok bool) {
+	snippet, err := app.snippetFromURL(r)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiNotFound(w)
+		} else {
+			app.apiServerError(w, err)
+		}
+		return nil, false
+	}
+
+	if snippet.UserID != app.authenticatedUserID(r) {
+		app.apiClientError(w, http.StatusForbidden, "you are not the owner of this snippet")
+		return nil, false
+	}
+
+	if snippet.Burned {
+		app.apiGone(w)
+		return nil, false
+	}
+
+	return snippet, true
+}
+
+// apiRequireAuthentication is the JSON counterpart of requireAuthentication.
+// Instead of redirecting to the login page, it responds with 401 Unauthorized.
+func (app *application) apiRequireAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.isAuthenticated(r) {
+			app.apiClientError(w, http.StatusUnauthorized, "you must be authenticated to access this resource")
+			return
+		}
+
+		// API tokens can only be created by users who have verified their email
+		// address, so only session-authenticated requests need checking
+		if app.requestToken(r) == nil && !app.isEmailVerified(r) {
+			app.apiClientError(w, http.StatusForbidden, "you must verify your email address first")
+			return
+		}
+
+		w.Header().Add("Cache-Control", "no-store")
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiNoSurf is the JSON counterpart of noSurf. Requests authenticated with the
+// session cookie must send the CSRF token in the X-CSRF-Token header, while
+// requests authenticated with an API token are exempt. It must therefore come
+// after app.authenticateToken in the middleware chain.
+func (app *application) apiNoSurf(next http.Handler) http.Handler {
+	csrfHandler := nosurf.New(next)
+	csrfHandler.ExemptFunc(func(r *http.Request) bool {
+		return app.requestToken(r) != nil
+	})
+	csrfHandler.SetBaseCookie(http.Cookie{
+		HttpOnly: true,
+		Path:     "/",
+		Secure:   true,
+	})
+	csrfHandler.SetFailureHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.apiClientError(w, http.StatusBadRequest, "missing or invalid CSRF token")
+	}))
+	return csrfHandler
+}
+
+// writeJSON encodes data as JSON and writes it to w with the given status.
+func (app *application) writeJSON(w http.ResponseWriter, status int, data any) {
+	js, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(js, '\n'))
+}
+
+// readJSON decodes a single JSON value from the request body into dst. Unknown
+// fields, trailing data and bodies larger than maxJSONBytes are rejected, and
+// the returned error is safe to show to the client.
+func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxJSONBytes)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		var unmarshalTypeError *json.UnmarshalTypeError
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &syntaxError):
+			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return errors.New("body contains badly-formed JSON")
+		case errors.As(err, &unmarshalTypeError):
+			return fmt.Errorf("body contains the wrong type for field %q", unmarshalTypeError.Field)
+		case errors.Is(err, io.EOF):
+			return errors.New("body must not be empty")
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			return fmt.Errorf("body contains unknown field %s", strings.TrimPrefix(err.Error(), "json: unknown field "))
+		case errors.As(err, &maxBytesError):
+			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+		default:
+			return err
+		}
+	}
+
+	// Decode again to make sure the body only contained a single JSON value
+	if err = dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		return errors.New("body must only contain a single JSON value")
+	}
+
+	return nil
+}
+
+// apiServerError is the JSON counterpart of serverError.
+func (app *application) apiServerError(w http.ResponseWriter, err error) {
+	trace := fmt.Sprintf("%s\n%s", err, debug.Stack())
+	app.errorLog.Output(2, trace)
+
+	app.writeJSON(w, http.StatusInternalServerError, apiError{Error: http.StatusText(http.StatusInternalServerError)})
+}
+
+// apiNotFound is the JSON counterpart of notFound.
+func (app *application) apiNotFound(w http.ResponseWriter) {
+	app.apiClientError(w, http.StatusNotFound, "the requested resource could not be found")
+}
+
+// apiGone is the JSON counterpart of gone.
+func (app *application) apiGone(w http.ResponseWriter) {
+	app.apiClientError(w, http.StatusGone, "the snippet was deleted after it was first viewed")
+}
+
+// apiClientError is the JSON counterpart of clientError. message describes the
+// problem to the client.
+func (app *application) apiClientError(w http.ResponseWriter, status int, message string) {
+	app.writeJSON(w, status, apiError{Error: message})
+}
+
+// apiInvalidToken responds with 401 when the Authorization header of a request
+// holds a missing, malformed, expired or revoked API token.
+func (app *application) apiInvalidToken(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	app.apiClientError(w, http.StatusUnauthorized, "invalid or expired API token")
+}
+
+// apiValidationError responds with 422 and the errors collected by v.
+func (app *application) apiValidationError(w http.ResponseWriter, v validator.Validator) {
+	app.writeJSON(w, http.StatusUnprocessableEntity, apiError{
+		Error:          "the request failed validation",
+		FieldErrors:    v.FieldErrors,
+		NonFieldErrors: v.NonFieldErrors,
+	})
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/mgxnch/snippetbox/internal/models"
+	"github.com/mgxnch/snippetbox/internal/signer"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// envPrefix is prepended to the environment variable of every setting, e.g.
+// SNIPPETBOX_SESSION_LIFETIME for -session-lifetime.
+const envPrefix = "SNIPPETBOX_"
+
+// defaultCSP is the Content-Security-Policy header sent when -csp is not set.
+const defaultCSP = "default-src 'self'; style-src: 'self' fonts.googleapis.com; font-src fonts.gstatic.com"
+
+// config holds the settings of the application. Every setting is a command-line
+// flag, and can also be set in the config file or in an environment variable.
+type config struct {
+	addr       string
+	baseURL    string // of the links in emails and the passkeys, e.g. https://snippetbox.example.com
+	signingKey string // hex-encoded
+	db         struct {
+		driver      string
+		dsn         string
+		autoMigrate bool
+	}
+	tls struct {
+		certFile string
+		keyFile  string
+	}
+	sessionLifetime time.Duration
+	unlockLifetime  time.Duration
+	bcryptCost      int
+	timeouts        struct {
+		read     time.Duration
+		write    time.Duration
+		idle     time.Duration
+		shutdown time.Duration
+	}
+	csp   string
+	purge struct {
+		interval time.Duration
+		grace    time.Duration
+		archive  bool
+	}
+	mail struct {
+		mailer string // smtp, file or log
+		from   string
+		dir    string // written to by the file mailer
+		smtp   struct {
+			addr     string
+			username string
+			password string
+		}
+	}
+
+	// These can only be set on the command line
+	file        string
+	printConfig bool
+}
+
+// loadConfig registers the settings as flags on fs and works out their values.
+// A setting is taken from the first of these that sets it:
+//
+//  1. the command-line flag, e.g. -session-lifetime=24h
+//  2. the environment variable, e.g. SNIPPETBOX_SESSION_LIFETIME=24h
+//  3. the JSON config file named by -config or SNIPPETBOX_CONFIG,
+//     e.g. {"session-lifetime": "24h"}
+//  4. the default value
+//
+// The command-line arguments that follow the flags are left in fs.Args().
+func loadConfig(fs *flag.FlagSet, args []string, lookupEnv func(string) (string, bool)) (*config, error) {
+	cfg := &config{}
+
+	fs.StringVar(&cfg.addr, "addr", ":4000", "HTTP port")
+	fs.StringVar(&cfg.baseURL, "base-url", "https://localhost:4000", "URL that the application is reached at, used in the links of emails; passkeys only work on its host")
+	fs.StringVar(&cfg.signingKey, "signing-key", "", "Hex-encoded secret key of at least 32 bytes that signs the links in emails; if empty, a random key is used, and links stop working on restart")
+	fs.StringVar(&cfg.db.driver, "db-driver", "mysql", "Storage backend: mysql, sqlite or memory")
+	fs.StringVar(&cfg.db.dsn, "dsn", "", "Data source name; a MySQL DSN or an SQLite file path, depending on -db-driver")
+	fs.BoolVar(&cfg.db.autoMigrate, "auto-migrate", false, "Apply pending schema migrations before starting the server")
+	fs.StringVar(&cfg.tls.certFile, "tls-cert", "./tls/cert.pem", "Path to the TLS certificate")
+	fs.StringVar(&cfg.tls.keyFile, "tls-key", "./tls/key.pem", "Path to the TLS private key")
+	fs.DurationVar(&cfg.sessionLifetime, "session-lifetime", 12*time.Hour, "How long a login session lasts")
+	fs.DurationVar(&cfg.unlockLifetime, "unlock-lifetime", time.Hour, "How long a password-protected snippet stays unlocked after its password is entered")
+	fs.IntVar(&cfg.bcryptCost, "bcrypt-cost", models.DefaultBcryptCost, "bcrypt cost of new password hashes")
+	fs.DurationVar(&cfg.timeouts.read, "read-timeout", 5*time.Second, "Maximum duration for reading a request")
+	fs.DurationVar(&cfg.timeouts.write, "write-timeout", 10*time.Second, "Maximum duration for writing a response")
+	fs.DurationVar(&cfg.timeouts.idle, "idle-timeout", time.Minute, "How long keep-alive connections are kept open while idle")
+	fs.DurationVar(&cfg.timeouts.shutdown, "shutdown-timeout", 30*time.Second, "How long to wait for in-flight requests when shutting down")
+	fs.StringVar(&cfg.csp, "csp", defaultCSP, "Content-Security-Policy header of every response; empty to leave it out")
+	fs.DurationVar(&cfg.purge.interval, "purge-interval", time.Hour, "How often to purge expired snippets and sessions; 0 disables purging")
+	fs.DurationVar(&cfg.purge.grace, "purge-grace", 7*24*time.Hour, "How long expired snippets are kept before they are purged")
+	fs.BoolVar(&cfg.purge.archive, "purge-archive", false, "Move purged snippets to the snippets_archive table instead of only deleting them")
+
+	fs.StringVar(&cfg.mail.mailer, "mailer", "log", "How emails are sent: smtp, file (written to -mail-dir) or log (only when base-url is on localhost)")
+	fs.StringVar(&cfg.mail.from, "mail-from", "Snippetbox <no-reply@snippetbox.local>", "Sender of emails")
+	fs.StringVar(&cfg.mail.dir, "mail-dir", "./tmp/mail", "Directory that the file mailer writes emails to")
+	fs.StringVar(&cfg.mail.smtp.addr, "smtp-addr", "localhost:587", "host:port of the SMTP server of the smtp mailer")
+	fs.StringVar(&cfg.mail.smtp.username, "smtp-username", "", "SMTP username; empty to send without authenticating")
+	fs.StringVar(&cfg.mail.smtp.password, "smtp-password", "", "SMTP password")
+
+	fs.StringVar(&cfg.file, "config", "", "Path to a JSON config file (env: "+envPrefix+"CONFIG)")
+	fs.BoolVar(&cfg.printConfig, "print-config", false, "Print the effective config, with secrets redacted, and exit")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	// The config file and the environment are applied on top of the flags, so
+	// we remember the flags that were set and apply them again at the end
+	fromFlags := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		fromFlags[f.Name] = f.Value.String()
+	})
+
+	if cfg.file == "" {
+		cfg.file, _ = lookupEnv(envPrefix + "CONFIG")
+	}
+	if cfg.file != "" {
+		if err = loadConfigFile(fs, cfg.file); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, name := range settingNames(fs) {
+		env := envName(name)
+		if value, ok := lookupEnv(env); ok {
+			if err = fs.Set(name, value); err != nil {
+				return nil, fmt.Errorf("environment variable %s: %w", env, err)
+			}
+		}
+	}
+
+	for name, value := range fromFlags {
+		fs.Set(name, value)
+	}
+
+	if err = cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.db.dsn == "" {
+		cfg.db.dsn = defaultDSNs[cfg.db.driver]
+	}
+
+	return cfg, nil
+}
+
+// loadConfigFile sets the flags of fs from the JSON object in the file at
+// path, whose keys are flag names.
+func loadConfigFile(fs *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	var settings map[string]json.RawMessage
+	if err = json.Unmarshal(data, &settings); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	names := settingNames(fs)
+
+	for _, name := range slices.Sorted(maps.Keys(settings)) {
+		if !slices.Contains(names, name) {
+			return fmt.Errorf("config file %s: unknown setting %q", path, name)
+		}
+
+		// Strings are unquoted, while numbers and booleans are used as they are
+		raw := settings[name]
+		var value string
+		if json.Unmarshal(raw, &value) != nil {
+			value = string(raw)
+		}
+
+		if err = fs.Set(name, value); err != nil {
+			return fmt.Errorf("config file %s: setting %q: %w", path, name, err)
+		}
+	}
+
+	return nil
+}
+
+// validate checks that the settings can be used to start the application.
+func (cfg *config) validate() error {
+	var errs []error
+
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(cfg.addr != "", "addr must not be empty")
+	check(slices.Contains([]string{"mysql", "sqlite", "memory"}, cfg.db.driver), "db-driver must be mysql, sqlite or memory, not %q", cfg.db.driver)
+	check(cfg.tls.certFile != "" && cfg.tls.keyFile != "", "tls-cert and tls-key must not be empty")
+	check(cfg.sessionLifetime > 0, "session-lifetime must be positive")
+	check(cfg.unlockLifetime > 0, "unlock-lifetime must be positive")
+	check(cfg.bcryptCost >= bcrypt.MinCost && cfg.bcryptCost <= bcrypt.MaxCost, "bcrypt-cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	check(cfg.timeouts.read > 0 && cfg.timeouts.write > 0 && cfg.timeouts.idle > 0, "read-timeout, write-timeout and idle-timeout must be positive")
+	check(cfg.timeouts.shutdown > 0, "shutdown-timeout must be positive")
+	check(cfg.purge.interval >= 0, "purge-interval must not be negative")
+	check(cfg.purge.grace >= 0, "purge-grace must not be negative")
+
+	u, err := url.Parse(cfg.baseURL)
+	check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "base-url must be an http or https URL, not %q", cfg.baseURL)
+	// The links in emails let anyone who reads them reset passwords, so they
+	// may only be written to the log during local development
+	check(cfg.mail.mailer != "log" || (err == nil && isLocalhost(u.Hostname())), "mailer must be smtp or file unless base-url is on localhost, as the log mailer writes the links in emails to the log")
+	if cfg.signingKey != "" {
+		key, err := hex.DecodeString(cfg.signingKey)
+		check(err == nil && len(key) >= signer.MinKeyLength, "signing-key must be at least %d hex-encoded bytes", signer.MinKeyLength)
+	}
+	check(slices.Contains([]string{"smtp", "file", "log"}, cfg.mail.mailer), "mailer must be smtp, file or log, not %q", cfg.mail.mailer)
+	_, err = mail.ParseAddress(cfg.mail.from)
+	check(err == nil, "mail-from must be an email address, not %q", cfg.mail.from)
+	check(cfg.mail.mailer != "smtp" || cfg.mail.smtp.addr != "", "smtp-addr must not be empty when mailer is smtp")
+	check(cfg.mail.mailer != "file" || cfg.mail.dir != "", "mail-dir must not be empty when mailer is file")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// isLocalhost returns true if host is localhost or a loopback IP address.
+func isLocalhost(host string) bool {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// print writes the value of every setting in fs to w as a JSON object,
+// in the same format as the config file. The password in the DSN, the signing
+// key and the SMTP password are redacted.
+func (cfg *config) print(w io.Writer, fs *flag.FlagSet) error {
+	settings := map[string]any{}
+
+	for _, name := range settingNames(fs) {
+		settings[name] = fs.Lookup(name).Value.(flag.Getter).Get()
+
+		// Durations would otherwise be printed in nanoseconds
+		if d, ok := settings[name].(time.Duration); ok {
+			settings[name] = d.String()
+		}
+	}
+	settings["dsn"] = cfg.redactedDSN()
+	for _, name := range []string{"signing-key", "smtp-password"} {
+		if settings[name] != "" {
+			settings[name] = "REDACTED"
+		}
+	}
+
+	// Without SetEscapeHTML, the angle brackets in mail-from would be printed
+	// as \u003c and \u003e
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "\t")
+	return enc.Encode(settings)
+}
+
+// redactedDSN returns the DSN with its password replaced by "REDACTED". The
+// rest of it is kept, as it is useful when debugging.
+func (cfg *config) redactedDSN() string {
+	if cfg.db.driver != "mysql" || cfg.db.dsn == "" {
+		return cfg.db.dsn
+	}
+
+	dsn, err := mysql.ParseDSN(cfg.db.dsn)
+	if err != nil {
+		// We can't tell which part is the password
+		return "REDACTED"
+	}
+	if dsn.Passwd != "" {
+		dsn.Passwd = "REDACTED"
+	}
+	return dsn.FormatDSN()
+}
+
+// settingNames returns the names of the flags in fs which can also be set in
+// the config file and the environment, in lexical order.
+func settingNames(fs *flag.FlagSet) []string {
+	var names []string
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name != "config" && f.Name != "print-config" {
+			names = append(names, f.Name)
+		}
+	})
+	return names
+}
+
+// envName returns the environment variable of the setting with the given
+// flag name.
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
@@ -3,6 +3,8 @@ package main
 type contextKey string
 
 const (
-	authUserKey               = "authenticatedUserID"   // key used for an authenticated user in Session Manager
-	isAuthenticatedContextKey = contextKey(authUserKey) // custom type wrapping authUserKey string
+	authUserKey               = "authenticatedUserID"       // key used for an authenticated user in Session Manager
+	isAuthenticatedContextKey = contextKey(authUserKey)     // custom type wrapping authUserKey string
+	tokenContextKey           = contextKey("apiToken")      // holds the *models.Token of a token-authenticated request
+	emailVerifiedContextKey   = contextKey("emailVerified") // true if the logged-in user has verified their email address
 )
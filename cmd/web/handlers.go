@@ -1,18 +1,49 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/justinas/nosurf"
+	"github.com/mgxnch/snippetbox/internal/diff"
 	"github.com/mgxnch/snippetbox/internal/models"
+	"github.com/mgxnch/snippetbox/internal/syntax"
 	"github.com/mgxnch/snippetbox/internal/validator"
 )
 
+// pageSizes are the choices of the number of snippets on each page of the
+// snippet archive.
+var pageSizes = []int{10, 25, 50}
+
+// snippetListForm holds the query string parameters of the snippet archive.
+type snippetListForm struct {
+	Sort     string `form:"sort"`
+	Size     int    `form:"size"`
+	Language string `form:"lang"`
+	After    int    `form:"after"`
+	Before   int    `form:"before"`
+}
+
+// snippetUnlockForm holds the password entered to view a password-protected
+// snippet.
+type snippetUnlockForm struct {
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+// errTooManyGuesses is returned by checkSnippetPassword once too many wrong
+// passwords were entered for a snippet, or by a client.
+var errTooManyGuesses = errors.New("too many wrong snippet passwords")
+
 // userSignupForm holds the information when a user signs up.
 type userSignupForm struct {
 	Name                string `form:"name"`
@@ -38,54 +69,304 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	tags, err := app.snippets.TagCounts(tagCloudSize)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
 	// Populate the templateData struct with data
 	data := app.newTemplateData(r)
 	data.Snippets = snippets
+	data.TagCloud = newTagCloud(tags)
 
 	// Render the page
 	app.render(w, http.StatusOK, "home.tmpl", data)
 }
 
 // snippetView is the function handler for viewing a specific snippet.
+// Password-protected snippets are only shown once their password has been
+// entered, see snippetUnlockPost. Burn-after-reading snippets are not shown
+// straight away. Instead, viewers are asked to confirm, so that link previews
+// and other bots which only follow links don't burn them.
 func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
-	id, err := strconv.Atoi(chi.URLParam(r, "id"))
-	if err != nil || id < 1 {
-		app.notFound(w)
+	snippet, ok := app.visibleSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.unlocked(r, snippet) {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Form = snippetUnlockForm{}
+		app.render(w, http.StatusOK, "unlock.tmpl", data)
+		return
+	}
+
+	if snippet.BurnAfterReading {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		app.render(w, http.StatusOK, "reveal.tmpl", data)
+		return
+	}
+
+	// The content of protected snippets must not be kept in shared caches
+	if snippet.Protected() {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+
+	// Populate the templateData struct with data
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+
+	// Render the page
+	app.render(w, http.StatusOK, "view.tmpl", data)
+}
+
+// snippetRevealPost burns a burn-after-reading snippet and shows it, once the
+// viewer has confirmed that they want to see it.
+func (app *application) snippetRevealPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.visibleSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	if !snippet.BurnAfterReading || !app.unlocked(r, snippet) {
+		http.Redirect(w, r, "/snippet/view/"+snippet.Ref(), http.StatusSeeOther)
 		return
 	}
 
-	// Fetch the snippet by its ID
-	snippet, err := app.snippets.Get(id)
+	// Only one of several concurrent viewers gets the snippet back
+	snippet, err := app.snippets.Burn(snippet.ID)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
-			app.notFound(w)
+			app.gone(w)
 		} else {
 			app.serverError(w, err)
 		}
 		return
 	}
 
-	// Populate the templateData struct with data
 	data := app.newTemplateData(r)
 	data.Snippet = snippet
 
-	// Render the page
+	// The snippet must not be kept anywhere now that it has been burned
+	w.Header().Set("Cache-Control", "no-store")
 	app.render(w, http.StatusOK, "view.tmpl", data)
 }
 
+// snippetUnlockPost checks the password entered for a password-protected
+// snippet. If it is right, the snippet stays unlocked in the session for
+// app.config.unlockLifetime, and the viewer is sent back to the snippet.
+func (app *application) snippetUnlockPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.visibleSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	if app.unlocked(r, snippet) {
+		http.Redirect(w, r, "/snippet/view/"+snippet.Ref(), http.StatusSeeOther)
+		return
+	}
+
+	var form snippetUnlockForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "unlock.tmpl", data)
+		return
+	}
+
+	wait, err := app.checkSnippetPassword(r, snippet, form.Password)
+	if err != nil {
+		status := http.StatusUnprocessableEntity
+		switch {
+		case errors.Is(err, errTooManyGuesses):
+			setRetryAfter(w, wait)
+			status = http.StatusTooManyRequests
+			form.AddNonFieldError("Too many incorrect passwords. Please try again later.")
+		case errors.Is(err, models.ErrInvalidCredentials):
+			form.AddFieldError("password", "Password is incorrect")
+		default:
+			app.serverError(w, err)
+			return
+		}
+
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Form = form
+		app.render(w, status, "unlock.tmpl", data)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), unlockedSnippetKey(snippet.ID), time.Now().Add(app.config.unlockLifetime).Unix())
+
+	http.Redirect(w, r, "/snippet/view/"+snippet.Ref(), http.StatusSeeOther)
+}
+
+// checkSnippetPassword compares a password entered for a protected snippet
+// with the snippet's password. It returns models.ErrInvalidCredentials if it
+// is wrong. Once too many wrong passwords were entered for the snippet or by
+// the client, every password is refused with errTooManyGuesses, along with
+// how long until the next one is allowed, since guessing could otherwise go
+// on until the right one is found.
+func (app *application) checkSnippetPassword(r *http.Request, snippet *models.Snippet, password string) (time.Duration, error) {
+	snippetKey := strconv.Itoa(snippet.ID)
+	clientKey := clientIP(r)
+
+	// Every password counts as a guess until it turns out to be right, so
+	// that concurrent requests can't all be let in before any of them is
+	// found to be wrong
+	if ok, wait := app.snippetGuesses.Try(snippetKey); !ok {
+		return wait, errTooManyGuesses
+	}
+	if ok, wait := app.clientGuesses.Try(clientKey); !ok {
+		app.snippetGuesses.Cancel(snippetKey)
+		return wait, errTooManyGuesses
+	}
+
+	err := models.CheckPassword(snippet.PasswordHash, password)
+	if !errors.Is(err, models.ErrInvalidCredentials) {
+		app.snippetGuesses.Cancel(snippetKey)
+		app.clientGuesses.Cancel(clientKey)
+	}
+	return 0, err
+}
+
+// snippetRaw writes the content of a snippet as plain text, so that it can be
+// fetched with tools like curl.
+func (app *application) snippetRaw(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.readableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, snippet.Content)
+}
+
+// snippetDownload is like snippetRaw, but has browsers save the content as a
+// file named after the snippet.
+func (app *application) snippetDownload(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.readableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": snippetFilename(snippet)})
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", disposition)
+	io.WriteString(w, snippet.Content)
+}
+
 // snippetCreateForm represents the form data and validation errors
-// for the snippetCreate form fields.
+// for the snippetCreate form fields. The json tags allow the same form to be
+// decoded from API request bodies.
 type snippetCreateForm struct {
-	Title               string     `form:"title"`
-	Content             string     `form:"content"`
-	Expires             int        `form:"expires"`
-	validator.Validator `form:"-"` // embedded struct
+	Title               string              `form:"title" json:"title"`
+	Content             string              `form:"content" json:"content"`
+	Format              string              `form:"format" json:"format"`                         // FormatCode if blank
+	Language            string              `form:"language" json:"language"`                     // detected from Content if blank
+	Visibility          string              `form:"visibility" json:"visibility"`                 // VisibilityPublic if blank
+	BurnAfterReading    bool                `form:"burn_after_reading" json:"burn_after_reading"` // deleted when first viewed
+	Password            string              `form:"password" json:"password"`                     // keeps the current password if blank
+	RemovePassword      bool                `form:"remove_password" json:"remove_password"`       // removes the current password
+	Tags                string              `form:"tags" json:"tags"`                             // comma-separated
+	Expires             int                 `form:"expires" json:"expires"`
+	validator.Validator `form:"-" json:"-"` // embedded struct
+}
+
+// maxSnippetChars is the longest content that a snippet may have, so that
+// snippets stay snippets, and comparing their revisions stays cheap.
+const maxSnippetChars = 100_000
+
+// validate runs the validation logic for title, content, format, language,
+// visibility, tags and expires. It is shared by every handler that accepts a
+// snippetCreateForm.
+func (form *snippetCreateForm) validate() {
+	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
+	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Content, maxSnippetChars), "content", "This field cannot be more than 100,000 characters long")
+	form.CheckField(validator.PermittedString(form.Format, "", models.FormatPlain, models.FormatCode, models.FormatMarkdown), "format", "This field must equal plain, code or markdown")
+	form.CheckField(form.Language == "" || validator.PermittedString(form.Language, syntax.Names()...), "language", "This field must be one of the listed languages")
+	form.CheckField(validator.PermittedString(form.Visibility, "", models.VisibilityPublic, models.VisibilityUnlisted, models.VisibilityPrivate), "visibility", "This field must equal public, unlisted or private")
+
+	tags := form.tagNames()
+	form.CheckField(validator.MaxItems(tags, 5), "tags", "This field cannot have more than 5 tags")
+	form.CheckField(validator.AllMaxChars(tags, 30), "tags", "Each tag cannot be more than 30 characters long")
+	form.CheckField(validator.AllMatch(tags, validator.TagRegex), "tags", "Tags can only contain letters, digits, '+', '-' and '.'")
+
+	form.CheckField(validator.PermittedInt(form.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+
+	// bcrypt only uses the first 72 bytes of a password
+	form.CheckField(len(form.Password) <= 72, "password", "This field cannot be more than 72 bytes long")
+	form.CheckField(form.Password == "" || !form.RemovePassword, "password", "This field must be blank when the password is removed")
+}
+
+// tagNames splits the Tags field into lowercase tag names, leaving out blank
+// and repeated names.
+func (form *snippetCreateForm) tagNames() []string {
+	var names []string
+	for _, name := range strings.Split(form.Tags, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// input returns the fields of the snippet that the form creates or edits. Only
+// code has a language, which is detected from the content if none was chosen.
+func (form *snippetCreateForm) input() models.SnippetInput {
+	format := form.Format
+	if format == "" {
+		format = models.FormatCode
+	}
+
+	language := ""
+	if format == models.FormatCode {
+		language = form.Language
+		if language == "" {
+			language = syntax.Detect(form.Content)
+		}
+	}
+
+	visibility := form.Visibility
+	if visibility == "" {
+		visibility = models.VisibilityPublic
+	}
+
+	return models.SnippetInput{
+		Title:            form.Title,
+		Content:          form.Content,
+		Format:           format,
+		Language:         language,
+		Visibility:       visibility,
+		BurnAfterReading: form.BurnAfterReading,
+		Tags:             form.tagNames(),
+		Expires:          form.Expires,
+	}
 }
 
 func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
 	data.Form = snippetCreateForm{
-		Expires: 365,
+		Format:     models.FormatCode,
+		Visibility: models.VisibilityPublic,
+		Expires:    365,
 	}
 	app.render(w, http.StatusOK, "create.tmpl", data)
 }
@@ -100,11 +381,7 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Validation logic for title, content and expires
-	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
-	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
-	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
-	form.CheckField(validator.PermittedInt(form.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+	form.validate()
 
 	// If there are any validation errors, re-render the create.tmpl template
 	if !form.Valid() {
@@ -114,7 +391,22 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	id, err := app.snippets.Insert(form.Title, form.Content, form.Expires)
+	in, err := app.snippetInput(&form, nil)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+
+	id, err := app.snippets.Insert(userID, in)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Fetch the snippet again, since unlisted snippets are viewed by their slug
+	snippet, err := app.snippets.Get(id, userID)
 	if err != nil {
 		app.serverError(w, err)
 		return
@@ -124,147 +416,1073 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 	app.sessionManager.Put(r.Context(), "flash", "Snippet created successfully")
 
 	// If snippet is successfully created, redirect user to the snippetView page
-	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+	http.Redirect(w, r, "/snippet/view/"+snippet.Ref(), http.StatusSeeOther)
 }
 
-func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
-	data.Form = userSignupForm{}
-	app.render(w, http.StatusOK, "signup.tmpl", data)
-}
+// snippetInput is like form.input, but also sets the hash of the snippet's
+// password. A blank password keeps the password of current, the snippet being
+// edited, unless the form removes it. current is nil for new snippets.
+func (app *application) snippetInput(form *snippetCreateForm, current *models.Snippet) (models.SnippetInput, error) {
+	in := form.input()
 
-func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
-	var form userSignupForm
+	switch {
+	case form.Password != "":
+		hash, err := models.HashPassword(form.Password, app.config.bcryptCost)
+		if err != nil {
+			return models.SnippetInput{}, err
+		}
+		in.PasswordHash = hash
+	case current != nil && !form.RemovePassword:
+		in.PasswordHash = current.PasswordHash
+	}
 
-	// Read submitted form fields
-	err := app.decodePostForm(r, &form)
+	return in, nil
+}
+
+// ownedSnippet fetches the snippet referred to in the URL and checks that it
+// belongs to the logged-in user and hasn't been burned. If it does not, the
+// appropriate error response is written to w and ok is false.
+func (app *application) ownedSnippet(w http.ResponseWriter, r *http.Request) (snippet *models.Snippet, ok bool) {
+	snippet, err := app.snippetFromURL(r)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
-		return
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return nil, false
 	}
 
-	// Validation
-	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
-	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
-	form.CheckField(validator.Matches(form.Email, validator.EmailRegex), "email", "This field must be a valid email address")
-	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
-	form.CheckField(validator.MinChars(form.Password, 8), "password", "This field must contain at least 8 characters")
+	if snippet.Burned {
+		app.gone(w)
+		return nil, false
+	}
 
-	// If error, return 422
-	if !form.Valid() {
-		data := app.newTemplateData(r)
-		data.Form = form // so that the fields filled in on the failed request still show up on the page, user doesn't need to rewrite
-		app.render(w, http.StatusUnprocessableEntity, "signup.tmpl", data)
-		return
+	// Only the creator of a snippet may change it
+	if snippet.UserID != app.authenticatedUserID(r) {
+		app.clientError(w, http.StatusForbidden)
+		return nil, false
 	}
 
-	// Create user in DB
-	err = app.users.Insert(form.Name, form.Email, form.Password)
-	if err != nil {
-		if errors.Is(err, models.ErrDuplicateEmail) {
-			form.AddFieldError("email", "Email address is already in use")
-			data := app.newTemplateData(r)
-			data.Form = form
-			app.render(w, http.StatusUnprocessableEntity, "signup.tmpl", data)
-			return
-		}
-		app.serverError(w, err)
+	return snippet, true
+}
+
+// snippetEdit is the function handler for displaying the edit form of a snippet.
+func (app *application) snippetEdit(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
 		return
 	}
 
-	// Let user know that signup was successful
-	app.sessionManager.Put(r.Context(), "flash", "Your signup was successful. Please log in.")
-
-	// Redirect user to login page
-	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
-}
+	// Preselect the shortest expiry option that does not cut the snippet's
+	// remaining lifetime short
+	expires := 365
+	for _, days := range []int{1, 7} {
+		if time.Until(snippet.Expires) <= time.Duration(days)*24*time.Hour {
+			expires = days
+			break
+		}
+	}
 
-func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
-	data.Form = userLoginForm{}
-	app.render(w, http.StatusOK, "login.tmpl", data)
+	data.Snippet = snippet
+	data.Form = snippetCreateForm{
+		Title:            snippet.Title,
+		Content:          snippet.Content,
+		Format:           snippet.Format,
+		Language:         snippet.Language,
+		Visibility:       snippet.Visibility,
+		BurnAfterReading: snippet.BurnAfterReading,
+		Tags:             strings.Join(snippet.Tags, ", "),
+		Expires:          expires,
+	}
+	app.render(w, http.StatusOK, "edit.tmpl", data)
 }
 
-func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
-	var form userLoginForm
+func (app *application) snippetEditPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	var form snippetCreateForm
 
-	// Read submitted form fields
 	err := app.decodePostForm(r, &form)
 	if err != nil {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	// Validation
-	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
-	form.CheckField(validator.Matches(form.Email, validator.EmailRegex), "email", "This field must be a valid email address")
-	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	form.validate()
 
-	// If form field values fail semantic validation, return 422
 	if !form.Valid() {
 		data := app.newTemplateData(r)
+		data.Snippet = snippet
 		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "login.tmpl", data)
+		app.render(w, http.StatusUnprocessableEntity, "edit.tmpl", data)
 		return
 	}
 
-	// Return an error if the user cannot be authenticated
-	id, err := app.users.Authenticate(form.Email, form.Password)
+	in, err := app.snippetInput(&form, snippet)
 	if err != nil {
-		if errors.Is(err, models.ErrInvalidCredentials) {
-			form.AddNonFieldError("Email or password is incorrect")
+		app.serverError(w, err)
+		return
+	}
 
-			data := app.newTemplateData(r)
-			data.Form = form
-			app.render(w, http.StatusUnprocessableEntity, "login.tmpl", data)
-			return
-		}
+	userID := app.authenticatedUserID(r)
 
+	err = app.snippets.Update(snippet.ID, userID, in)
+	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	// Call RenewToken on the current session to change the session ID. It is a good
-	// practice to generate a new session ID when the authentication state or privilege
-	// levels changes for a user (e.g. login and logout operations)
-	err = app.sessionManager.RenewToken(r.Context())
+	// The snippet has a new slug if it was made unlisted for the first time
+	snippet, err = app.snippets.Get(snippet.ID, userID)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	// Add the ID of the current user to the session, so that they are now considered
-	// logged in.
-	app.sessionManager.Put(r.Context(), authUserKey, id)
+	app.sessionManager.Put(r.Context(), "flash", "Snippet updated successfully")
 
-	// Redirect user to the create snippet page
-	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+	http.Redirect(w, r, "/snippet/view/"+snippet.Ref(), http.StatusSeeOther)
 }
 
-func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
-	err := app.sessionManager.RenewToken(r.Context())
+func (app *application) snippetDeletePost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.snippets.Delete(snippet.ID)
 	if err != nil {
-		app.serverError(w, err)
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
 		return
 	}
 
-	// Remove key-value of the authenticated uesr
-	app.sessionManager.Remove(r.Context(), authUserKey)
+	app.sessionManager.Put(r.Context(), "flash", "Snippet deleted successfully")
 
-	// Inform user
-	app.sessionManager.Put(r.Context(), "flash", "You've been logged out successfully")
+	http.Redirect(w, r, "/snippet/mine", http.StatusSeeOther)
+}
 
-	// Redirect user to home page
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+// snippetFromURL fetches the snippet referred to by the id URL parameter, as
+// seen by the logged-in user. The parameter holds either the public ID of the
+// snippet or, for unlisted snippets, its slug. Snippets that the user may not
+// see are reported as models.ErrNoRecord, so that their existence isn't
+// revealed. Integer IDs are handled by app.redirectLegacyID instead.
+func (app *application) snippetFromURL(r *http.Request) (*models.Snippet, error) {
+	ref := chi.URLParam(r, "id")
+	userID := app.authenticatedUserID(r)
+
+	snippet, err := app.snippets.GetByPublicID(ref, userID)
+	if errors.Is(err, models.ErrNoRecord) {
+		return app.snippets.GetBySlug(ref, userID)
+	}
+	return snippet, err
+}
+
+// visibleSnippet fetches the snippet referred to in the URL. If it cannot be
+// viewed, or has been burned, the appropriate error response is written to w
+// and ok is false.
+func (app *application) visibleSnippet(w http.ResponseWriter, r *http.Request) (snippet *models.Snippet, ok bool) {
+	snippet, err := app.snippetFromURL(r)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return nil, false
+	}
+
+	if snippet.Burned {
+		app.gone(w)
+		return nil, false
+	}
+
+	return snippet, true
+}
+
+// readableSnippet is like visibleSnippet, but sends the viewers of
+// burn-after-reading snippets, and of password-protected snippets which they
+// haven't unlocked, to the snippet's page instead, where they must confirm or
+// enter the password before its content is shown.
+func (app *application) readableSnippet(w http.ResponseWriter, r *http.Request) (snippet *models.Snippet, ok bool) {
+	snippet, ok = app.visibleSnippet(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if snippet.BurnAfterReading || !app.unlocked(r, snippet) {
+		http.Redirect(w, r, "/snippet/view/"+snippet.Ref(), http.StatusSeeOther)
+		return nil, false
+	}
+
+	return snippet, true
+}
+
+// snippetHistory is the function handler for listing the revisions of a snippet.
+func (app *application) snippetHistory(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.readableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := app.snippets.Revisions(snippet.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Revisions = revisions
+
+	app.render(w, http.StatusOK, "history.tmpl", data)
+}
+
+// snippetDiff is the function handler for comparing two revisions of a snippet.
+// The versions are read from the "from" and "to" query parameters, and default
+// to the latest revision and the one before it.
+func (app *application) snippetDiff(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.readableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := app.snippets.Revisions(snippet.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if len(revisions) == 0 {
+		app.notFound(w)
+		return
+	}
+
+	// Revisions are ordered newest first
+	to := revisions[0].Version
+	if v := r.URL.Query().Get("to"); v != "" {
+		to, err = strconv.Atoi(v)
+		if err != nil {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+	from := to - 1
+	if v := r.URL.Query().Get("from"); v != "" {
+		from, err = strconv.Atoi(v)
+		if err != nil {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	var d revisionDiff
+	for _, revision := range revisions {
+		switch revision.Version {
+		case from:
+			d.From = revision
+		case to:
+			d.To = revision
+		}
+	}
+	if d.From == nil || d.To == nil {
+		app.notFound(w)
+		return
+	}
+	d.Hunks, err = diff.Unified(d.From.Content, d.To.Content, 3)
+	if err != nil {
+		if !errors.Is(err, diff.ErrTooLarge) {
+			app.serverError(w, err)
+			return
+		}
+		d.TooLarge = true
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Revisions = revisions
+	data.Diff = &d
+
+	app.render(w, http.StatusOK, "diff.tmpl", data)
+}
+
+func (app *application) snippetRestorePost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil || version < 1 {
+		app.notFound(w)
+		return
+	}
+
+	err = app.snippets.Restore(snippet.ID, app.authenticatedUserID(r), version)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Revision %d restored successfully", version))
+
+	http.Redirect(w, r, "/snippet/view/"+snippet.Ref(), http.StatusSeeOther)
+}
+
+// snippetMine is the function handler for listing every snippet created by
+// the logged-in user, including the ones that have already expired.
+func (app *application) snippetMine(w http.ResponseWriter, r *http.Request) {
+	snippets, err := app.snippets.ByUser(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippets = snippets
+
+	app.render(w, http.StatusOK, "mine.tmpl", data)
+}
+
+// snippetArchive displays a page of every unexpired snippet, so that older
+// snippets can be found without knowing their IDs.
+func (app *application) snippetArchive(w http.ResponseWriter, r *http.Request) {
+	app.snippetList(w, r, "")
+}
+
+// tagView displays a page of the unexpired snippets with the tag in the URL.
+func (app *application) tagView(w http.ResponseWriter, r *http.Request) {
+	tag := chi.URLParam(r, "name")
+	if !validator.Matches(tag, validator.TagRegex) {
+		app.notFound(w)
+		return
+	}
+
+	app.snippetList(w, r, tag)
+}
+
+// snippetList renders the page of snippets selected by the query string, which
+// is decoded into a snippetListForm. If tag is not empty, only the snippets
+// with that tag are listed.
+func (app *application) snippetList(w http.ResponseWriter, r *http.Request, tag string) {
+	form := snippetListForm{
+		Sort: models.SortNewest,
+		Size: pageSizes[0],
+	}
+
+	err := app.decodeQuery(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// The parameters come from the links and controls on the page, so there is
+	// no need to tell users which of them is wrong
+	valid := validator.PermittedString(form.Sort, models.SortNewest, models.SortOldest) &&
+		validator.PermittedInt(form.Size, pageSizes...) &&
+		(form.Language == "" || validator.PermittedString(form.Language, syntax.Names()...)) &&
+		form.After >= 0 && form.Before >= 0 &&
+		(form.After == 0 || form.Before == 0)
+	if !valid {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	list, err := app.snippets.List(models.ListOptions{
+		Sort:     form.Sort,
+		Size:     form.Size,
+		Tag:      tag,
+		Language: form.Language,
+		After:    form.After,
+		Before:   form.Before,
+	})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.List = list
+	data.PageSizes = pageSizes
+	data.Form = form
+
+	app.render(w, http.StatusOK, "archive.tmpl", data)
+}
+
+// search displays the page of snippets matching the q query string parameter
+// given by the page parameter.
+func (app *application) search(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	page, err := queryInt(r, "page", 1)
+	if err != nil || page < 1 {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	data := app.newTemplateData(r)
+
+	// Without a query, only the search form is shown
+	if query != "" {
+		data.Search, err = app.snippets.Search(query, app.authenticatedUserID(r), page)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	app.render(w, http.StatusOK, "search.tmpl", data)
+}
+
+func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userSignupForm{}
+	app.render(w, http.StatusOK, "signup.tmpl", data)
+}
+
+func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
+	var form userSignupForm
+
+	// Read submitted form fields
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// Validation
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRegex), "email", "This field must be a valid email address")
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	form.CheckField(validator.MinChars(form.Password, 8), "password", "This field must contain at least 8 characters")
+
+	// If error, return 422
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form // so that the fields filled in on the failed request still show up on the page, user doesn't need to rewrite
+		app.render(w, http.StatusUnprocessableEntity, "signup.tmpl", data)
+		return
+	}
+
+	// Create user in DB
+	err = app.users.Insert(form.Name, form.Email, form.Password)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateEmail) {
+			form.AddFieldError("email", "Email address is already in use")
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, http.StatusUnprocessableEntity, "signup.tmpl", data)
+			return
+		}
+		app.serverError(w, err)
+		return
+	}
+
+	user, err := app.users.GetByEmail(form.Email)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.verifyEmails.Add(strconv.Itoa(user.ID))
+	app.sendVerification(user)
+
+	// Let user know that signup was successful
+	app.sessionManager.Put(r.Context(), "flash", "Your signup was successful. Please log in, and verify your email address with the link that we've sent you.")
+
+	// Redirect user to login page
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userLoginForm{}
+	app.render(w, http.StatusOK, "login.tmpl", data)
+}
+
+func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
+	var form userLoginForm
+
+	// Read submitted form fields
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// Validation
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRegex), "email", "This field must be a valid email address")
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+
+	// If form field values fail semantic validation, return 422
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "login.tmpl", data)
+		return
+	}
+
+	// Every wrong password makes both the account and the client wait twice as
+	// long before they may try again, and enough of them lock the account out
+	// for a while, so that passwords can't be guessed one after another.
+	// Attempts still being checked count towards the lockout, so that
+	// concurrent requests can't all be let in before any of them is found to be
+	// wrong. The client's failures aren't forgotten when it logs in, or it could
+	// log into its own account between guesses.
+	accountKey := strings.ToLower(form.Email)
+	clientKey := clientIP(r)
+	okAccount, wait := app.accountLogins.Try(accountKey)
+	okClient := false
+	if okAccount {
+		okClient, wait = app.clientLogins.Try(clientKey)
+		if !okClient {
+			app.accountLogins.Cancel(accountKey)
+		}
+	}
+	if !okClient {
+		setRetryAfter(w, wait)
+		form.AddNonFieldError("Too many attempts. Please try again later.")
+
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusTooManyRequests, "login.tmpl", data)
+		return
+	}
+
+	// Return an error if the user cannot be authenticated
+	id, err := app.users.Authenticate(form.Email, form.Password)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			app.clientLogins.Fail(clientKey)
+			if app.accountLogins.Fail(accountKey) {
+				err = app.sendLockoutNotice(form.Email, clientKey)
+				if err != nil {
+					app.serverError(w, err)
+					return
+				}
+			}
+
+			form.AddNonFieldError("Email or password is incorrect")
+
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, http.StatusUnprocessableEntity, "login.tmpl", data)
+			return
+		}
+
+		app.accountLogins.Cancel(accountKey)
+		app.clientLogins.Cancel(clientKey)
+		app.serverError(w, err)
+		return
+	}
+	app.accountLogins.Reset(accountKey)
+	app.clientLogins.Cancel(clientKey)
+
+	// Users who have turned on two-factor authentication must also enter a
+	// code before they are logged in
+	_, err = app.twoFactor.Get(id)
+	if err == nil {
+		app.startTwoFactorLogin(w, r, id)
+		return
+	}
+	if !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return
+	}
+
+	// Call RenewToken on the current session to change the session ID. It is a good
+	// practice to generate a new session ID when the authentication state or privilege
+	// levels changes for a user (e.g. login and logout operations)
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Add the ID of the current user to the session, so that they are now considered
+	// logged in.
+	app.sessionManager.Put(r.Context(), authUserKey, id)
+
+	// Redirect user to the create snippet page
+	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+}
+
+// accountLockout is how long an account can't be logged into after too many
+// wrong passwords in a row, which the email in ui/email/account_locked.tmpl
+// tells users.
+const accountLockout = 15 * time.Minute
+
+// sendLockoutNotice emails the owner of the account with the given email, if
+// there is one, that it has just been locked out after too many wrong
+// passwords from the client with the IP address ip.
+func (app *application) sendLockoutNotice(email, ip string) error {
+	user, err := app.users.GetByEmail(email)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil
+		}
+		return err
+	}
+
+	app.sendEmail(user.Email, "account_locked.tmpl", map[string]string{
+		"Name": user.Name,
+		"IP":   ip,
+		"URL":  app.config.baseURL + "/user/password/forgot",
+		"TTL":  humanDuration(accountLockout),
+	})
+	return nil
+}
+
+func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Remove key-value of the authenticated uesr
+	app.sessionManager.Remove(r.Context(), authUserKey)
+
+	// Inform user
+	app.sessionManager.Put(r.Context(), "flash", "You've been logged out successfully")
+
+	// Redirect user to home page
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+
+}
+
+// passwordResetTTL is how long a password reset link works, which the email in
+// ui/email/password_reset.tmpl tells users.
+const passwordResetTTL = time.Hour
+
+// userPasswordForgotForm holds the information when a user asks for a password
+// reset link.
+type userPasswordForgotForm struct {
+	Email               string `form:"email"`
+	validator.Validator `form:"-"`
+}
+
+// userPasswordResetForm holds the information when a user chooses a new
+// password through a reset link.
+type userPasswordResetForm struct {
+	Password            string `form:"password"`
+	Token               string `form:"-"` // from the URL
+	validator.Validator `form:"-"`
+}
+
+func (app *application) passwordForgot(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userPasswordForgotForm{}
+	app.render(w, http.StatusOK, "forgot.tmpl", data)
+}
+
+func (app *application) passwordForgotPost(w http.ResponseWriter, r *http.Request) {
+	var form userPasswordForgotForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRegex), "email", "This field must be a valid email address")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "forgot.tmpl", data)
+		return
+	}
+
+	err = app.sendPasswordReset(form.Email)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// The response is the same whether or not there is an account with the
+	// email, so that it doesn't reveal who has one
+	app.sessionManager.Put(r.Context(), "flash", "If an account uses that email address, we've sent it a link to reset the password.")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// sendPasswordReset emails a password reset link to the user with the given
+// email, if there is one. Users get at most a few links an hour, so that the
+// form can't be used to flood someone's inbox; further requests are ignored.
+func (app *application) sendPasswordReset(email string) error {
+	user, err := app.users.GetByEmail(email)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil
+		}
+		return err
+	}
+
+	key := strconv.Itoa(user.ID)
+	if ok, _ := app.resetEmails.Try(key); !ok {
+		return nil
+	}
+
+	token, err := app.resets.Insert(user.ID, passwordResetTTL)
+	if err != nil {
+		app.resetEmails.Cancel(key)
+		return err
+	}
+
+	app.sendEmail(user.Email, "password_reset.tmpl", map[string]string{
+		"Name": user.Name,
+		"URL":  app.config.baseURL + "/user/password/reset/" + token,
+		"TTL":  humanDuration(passwordResetTTL),
+	})
+	return nil
+}
+
+// invalidResetLink sends the user back to ask for a new password reset link,
+// for when theirs is unknown, expired or already used.
+func (app *application) invalidResetLink(w http.ResponseWriter, r *http.Request) {
+	app.sessionManager.Put(r.Context(), "flash", "That password reset link is invalid or has expired. Please ask for a new one.")
+	http.Redirect(w, r, "/user/password/forgot", http.StatusSeeOther)
+}
+
+func (app *application) passwordReset(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	_, err := app.resets.Get(token)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			app.invalidResetLink(w, r)
+			return
+		}
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = userPasswordResetForm{Token: token}
+	app.render(w, http.StatusOK, "reset.tmpl", data)
+}
+
+func (app *application) passwordResetPost(w http.ResponseWriter, r *http.Request) {
+	form := userPasswordResetForm{Token: chi.URLParam(r, "token")}
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	form.CheckField(validator.MinChars(form.Password, 8), "password", "This field must contain at least 8 characters")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "reset.tmpl", data)
+		return
+	}
+
+	// Redeem uses the token up, so that the link can't be used again
+	userID, err := app.resets.Redeem(form.Token)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			app.invalidResetLink(w, r)
+			return
+		}
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.users.UpdatePassword(userID, form.Password)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Whoever knew the old password may have logged in with it or created API
+	// tokens, so the user is logged out everywhere and their tokens stop
+	// working. This request's own session is renewed instead, as it is saved
+	// again at the end of the request.
+	err = app.tokens.RevokeAll(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.destroySessions(r.Context(), userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Remove(r.Context(), authUserKey)
+
+	// The reset link was emailed to the user, so they have proven that the
+	// address is theirs just like with a verification link
+	err = app.users.VerifyEmail(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your password has been reset. Please log in.")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// destroySessions destroys every session in which the user with userID is
+// logged in, or has entered their password but not yet their two-factor code.
+func (app *application) destroySessions(ctx context.Context, userID int) error {
+	return app.sessionManager.Iterate(ctx, func(ctx context.Context) error {
+		if app.sessionManager.GetInt(ctx, authUserKey) != userID && app.sessionManager.GetInt(ctx, twoFactorUserKey) != userID {
+			return nil
+		}
+		return app.sessionManager.Destroy(ctx)
+	})
+}
+
+// verifyEmailPurpose is the purpose of the signed tokens in email verification
+// links, see signer.Signer.Sign.
+const verifyEmailPurpose = "verify-email"
+
+// verificationTTL is how long an email verification link works, which the email
+// in ui/email/verify_email.tmpl tells users.
+const verificationTTL = 48 * time.Hour
+
+// sendVerification emails a link to the user that verifies their email
+// address. The link holds a signed token with the user's ID and address, so
+// nothing needs to be stored, and the link stops working if the address
+// changes. Callers count the email against verifyEmails.
+func (app *application) sendVerification(user *models.User) {
+	msg := strconv.Itoa(user.ID) + ":" + user.Email
+	token := app.signer.Sign(verifyEmailPurpose, msg, time.Now().Add(verificationTTL))
+
+	app.sendEmail(user.Email, "verify_email.tmpl", map[string]string{
+		"Name": user.Name,
+		"URL":  app.config.baseURL + "/user/verify/" + token,
+		"TTL":  humanDuration(verificationTTL),
+	})
+}
+
+// verifyEmail verifies the email address of a user with the link from their
+// verification email. It doesn't require the user to be logged in, as the link
+// may well be opened in another browser.
+func (app *application) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	invalid := func() {
+		app.sessionManager.Put(r.Context(), "flash", "That verification link is invalid or has expired. Please log in to ask for a new one.")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+	}
+
+	msg, err := app.signer.Verify(verifyEmailPurpose, chi.URLParam(r, "token"))
+	if err != nil {
+		invalid()
+		return
+	}
+
+	idText, email, _ := strings.Cut(msg, ":")
+	id, err := strconv.Atoi(idText)
+	if err != nil {
+		invalid()
+		return
+	}
+
+	user, err := app.users.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			invalid()
+			return
+		}
+		app.serverError(w, err)
+		return
+	}
+	if user.Email != email {
+		invalid()
+		return
+	}
+
+	if !user.EmailVerified {
+		err = app.users.VerifyEmail(user.ID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your email address has been verified.")
+	if app.isAuthenticated(r) {
+		http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+	} else {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+	}
+}
+
+// verifyResendPost emails another verification link to the logged-in user.
+// Users get at most a few links an hour, so that they can't flood their inbox,
+// or someone else's.
+func (app *application) verifyResendPost(w http.ResponseWriter, r *http.Request) {
+	user, err := app.users.Get(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if user.EmailVerified {
+		app.sessionManager.Put(r.Context(), "flash", "Your email address is already verified.")
+		http.Redirect(w, r, "/user/account", http.StatusSeeOther)
+		return
+	}
+
+	if ok, _ := app.verifyEmails.Try(strconv.Itoa(user.ID)); !ok {
+		app.sessionManager.Put(r.Context(), "flash", "We've sent you too many verification emails. Please try again later.")
+		http.Redirect(w, r, "/user/account", http.StatusSeeOther)
+		return
+	}
+
+	app.sendVerification(user)
+
+	app.sessionManager.Put(r.Context(), "flash", "We've sent you another verification email.")
+	http.Redirect(w, r, "/user/account", http.StatusSeeOther)
+}
+
+// tokenCreateForm holds the information when a user creates an API token.
+type tokenCreateForm struct {
+	Name                string `form:"name"`
+	Scope               string `form:"scope"`
+	Expires             int    `form:"expires"` // lifetime in days, 0 for tokens that never expire
+	validator.Validator `form:"-"`
+}
+
+// userAccount is the function handler for the account page, where the user
+// manages their passkeys and API tokens.
+func (app *application) userAccount(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = tokenCreateForm{
+		Scope:   models.ScopeRead,
+		Expires: 90,
+	}
+
+	app.renderAccount(w, r, http.StatusOK, data)
+}
+
+// renderAccount fetches the user, their passkeys and their API tokens into
+// data and renders the account page.
+func (app *application) renderAccount(w http.ResponseWriter, r *http.Request, status int, data *templateData) {
+	user, err := app.users.Get(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	tokens, err := app.tokens.ForUser(user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	twoFactor, err := app.twoFactor.Get(user.ID)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return
+	}
+
+	passkeys, err := app.passkeys.ForUser(user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data.User = user
+	data.Passkeys = passkeys
+	data.Tokens = tokens
+	data.TwoFactor = twoFactor
+	// The plaintext of a new token is only ever shown once, right after it is created
+	data.NewToken = app.sessionManager.PopString(r.Context(), "newToken")
+	data.RecoveryCodes = strings.Fields(app.sessionManager.PopString(r.Context(), recoveryCodesKey))
+
+	app.render(w, status, "account.tmpl", data)
+}
+
+func (app *application) tokenCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form tokenCreateForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Name, 100), "name", "This field cannot be more than 100 characters long")
+	form.CheckField(validator.PermittedString(form.Scope, models.ScopeRead, models.ScopeWrite), "scope", "This field must equal read or write")
+	form.CheckField(validator.PermittedInt(form.Expires, 0, 30, 90, 365), "expires", "This field must equal 0, 30, 90 or 365")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.renderAccount(w, r, http.StatusUnprocessableEntity, data)
+		return
+	}
+
+	ttl := time.Duration(form.Expires) * 24 * time.Hour
+	plaintext, err := app.tokens.Insert(app.authenticatedUserID(r), form.Name, form.Scope, ttl)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "newToken", plaintext)
+	app.sessionManager.Put(r.Context(), "flash", "Token created successfully. Copy it now, it won't be shown again.")
+
+	http.Redirect(w, r, "/user/account", http.StatusSeeOther)
+}
+
+func (app *application) tokenRevokePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	// Tokens of other users are treated as if they don't exist
+	err = app.tokens.Revoke(id, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Token revoked successfully")
 
+	http.Redirect(w, r, "/user/account", http.StatusSeeOther)
 }
 
 // newTemplateData returns a templateData struct with its commonly-used fields populated with data.
 func (app *application) newTemplateData(r *http.Request) *templateData {
 	return &templateData{
-		CurrentYear:     time.Now().Year(),
-		Flash:           app.sessionManager.PopString(r.Context(), "flash"),
-		IsAuthenticated: app.isAuthenticated(r),
-		CSRFToken:       nosurf.Token(r),
+		CurrentYear:         time.Now().Year(),
+		Languages:           syntax.Languages,
+		Flash:               app.sessionManager.PopString(r.Context(), "flash"),
+		IsAuthenticated:     app.isAuthenticated(r),
+		AuthenticatedUserID: app.authenticatedUserID(r),
+		CSRFToken:           nosurf.Token(r),
 	}
 }
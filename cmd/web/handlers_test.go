@@ -0,0 +1,365 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mgxnch/snippetbox/internal/models"
+	"github.com/mgxnch/snippetbox/internal/ratelimit"
+)
+
+func TestSnippetRevealConcurrent(t *testing.T) {
+	for _, driver := range testDrivers() {
+		t.Run(driver, func(t *testing.T) {
+			store := newTestStorage(t, driver)
+			app := newTestApplicationFor(t, store)
+			snippet := insertTestSnippet(t, store, models.SnippetInput{BurnAfterReading: true})
+
+			ts := newTestServer(t, app.routes())
+			ts.csrfToken(t)
+
+			// Viewers reveal the snippet at once through both the page and the
+			// API, and exactly one of them gets to see it
+			var mu sync.Mutex
+			codes := make(map[int]int)
+			var wg sync.WaitGroup
+			for range 10 {
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+
+					code, _, _ := ts.postForm(t, "/snippet/reveal/"+snippet.Ref(), nil)
+
+					mu.Lock()
+					codes[code]++
+					mu.Unlock()
+				}()
+				go func() {
+					defer wg.Done()
+
+					code, _, _ := ts.get(t, "/api/v1/snippets/"+snippet.Ref())
+
+					mu.Lock()
+					codes[code]++
+					mu.Unlock()
+				}()
+			}
+			wg.Wait()
+
+			if codes[http.StatusOK] != 1 || codes[http.StatusGone] != 19 {
+				t.Errorf("got status codes %v, want one 200 and 19 410", codes)
+			}
+		})
+	}
+}
+
+func TestSnippetPasswordGuesses(t *testing.T) {
+	app := newTestApplication(t)
+	app.clientGuesses = ratelimit.New(1000, time.Hour)
+
+	if err := app.users.Insert("Alice", "alice@example.com", "pa$$word"); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := models.HashPassword("secret", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := app.snippets.Insert(1, models.SnippetInput{
+		Title:        "Protected",
+		Content:      "Hidden",
+		Format:       models.FormatPlain,
+		Visibility:   models.VisibilityPublic,
+		PasswordHash: hash,
+		Expires:      1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snippet, err := app.snippets.Get(id, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := newTestServer(t, app.routes())
+	ts.csrfToken(t)
+
+	getSnippet := func(password string) int {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/snippets/"+snippet.Ref(), nil)
+		if err != nil {
+			t.Error(err)
+			return 0
+		}
+		req.Header.Set("X-Snippet-Password", password)
+		rs, err := ts.Client().Do(req)
+		if err != nil {
+			t.Error(err)
+			return 0
+		}
+		rs.Body.Close()
+		return rs.StatusCode
+	}
+
+	// The right password doesn't use up a guess
+	for i := range 25 {
+		if code := getSnippet("secret"); code != http.StatusOK {
+			t.Fatalf("right password %d: got %d", i+1, code)
+		}
+	}
+
+	// Wrong passwords are sent at once through both the API and the form, and
+	// no more of them than the limit of the snippet may be checked
+	var mu sync.Mutex
+	codes := make(map[int]int)
+	var wg sync.WaitGroup
+	for range 30 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+
+			code := getSnippet("wrong")
+
+			mu.Lock()
+			codes[code]++
+			mu.Unlock()
+		}()
+		go func() {
+			defer wg.Done()
+
+			code, _, _ := ts.postForm(t, "/snippet/unlock/"+snippet.Ref(), url.Values{"password": {"wrong"}})
+
+			mu.Lock()
+			codes[code]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	checked := codes[http.StatusForbidden] + codes[http.StatusUnprocessableEntity]
+	if checked != 20 || codes[http.StatusTooManyRequests] != 40 {
+		t.Errorf("got status codes %v, want 20 passwords checked and 40 refused", codes)
+	}
+
+	if code := getSnippet("secret"); code != http.StatusTooManyRequests {
+		t.Errorf("right password after too many guesses: got %d", code)
+	}
+}
+
+// newLoginTestServer returns a server of app with the users Alice and Bob,
+// whose password is "pa$$word", and a login function for it.
+func newLoginTestServer(t *testing.T, app *application) func(email, password string) (int, http.Header, string) {
+	t.Helper()
+
+	if err := app.users.Insert("Alice", "alice@example.com", "pa$$word"); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.users.Insert("Bob", "bob@example.com", "pa$$word"); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := newTestServer(t, app.routes())
+	ts.csrfToken(t)
+
+	return func(email, password string) (int, http.Header, string) {
+		t.Helper()
+		return ts.postForm(t, "/user/login", url.Values{"email": {email}, "password": {password}})
+	}
+}
+
+func TestUserLoginBackoff(t *testing.T) {
+	app := newTestApplication(t)
+	app.clientLogins = ratelimit.NewBackoff(0, 50, time.Hour)
+	login := newLoginTestServer(t, app)
+
+	code, _, _ := login("alice@example.com", "wrong")
+	if code != http.StatusUnprocessableEntity {
+		t.Fatalf("wrong password: got %d", code)
+	}
+
+	// Even the right password must wait until the backoff has passed, and so
+	// must the same email address spelled differently
+	code, header, body := login("Alice@Example.com", "pa$$word")
+	if code != http.StatusTooManyRequests || header.Get("Retry-After") != "1" {
+		t.Fatalf("retrying at once: got %d with Retry-After %q", code, header.Get("Retry-After"))
+	}
+	if !strings.Contains(body, "Too many attempts") {
+		t.Errorf("retrying at once: no error in body")
+	}
+
+	code, _, _ = login("bob@example.com", "pa$$word")
+	if code != http.StatusSeeOther {
+		t.Errorf("another account: got %d", code)
+	}
+}
+
+func TestUserLoginLockout(t *testing.T) {
+	app := newTestApplication(t)
+	app.accountLogins = ratelimit.NewBackoff(0, 5, time.Hour)
+	app.clientLogins = ratelimit.NewBackoff(0, 1000, time.Hour)
+	login := newLoginTestServer(t, app)
+
+	// Wrong passwords are sent at once, and no more of them than the limit
+	// may be checked before the account is locked out
+	var mu sync.Mutex
+	codes := make(map[int]int)
+	var wg sync.WaitGroup
+	for range 30 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			code, _, _ := login("alice@example.com", "wrong")
+
+			mu.Lock()
+			codes[code]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if codes[http.StatusUnprocessableEntity] != 5 || codes[http.StatusTooManyRequests] != 25 {
+		t.Errorf("got status codes %v, want 5 passwords checked and 25 refused", codes)
+	}
+
+	code, header, _ := login("alice@example.com", "pa$$word")
+	if code != http.StatusTooManyRequests || header.Get("Retry-After") != "3600" {
+		t.Errorf("right password after the lockout: got %d with Retry-After %q", code, header.Get("Retry-After"))
+	}
+
+	msgs := app.mailer.(*testMailer).messages(app)
+	if len(msgs) != 1 {
+		t.Fatalf("got %d emails, want 1", len(msgs))
+	}
+	if msgs[0].To != "alice@example.com" || !strings.Contains(msgs[0].Body, "127.0.0.1") {
+		t.Errorf("got email to %s: %s", msgs[0].To, msgs[0].Body)
+	}
+
+	code, _, _ = login("bob@example.com", "pa$$word")
+	if code != http.StatusSeeOther {
+		t.Errorf("another account: got %d", code)
+	}
+}
+
+func TestUserLoginReset(t *testing.T) {
+	app := newTestApplication(t)
+	app.accountLogins = ratelimit.NewBackoff(0, 2, time.Hour)
+	app.clientLogins = ratelimit.NewBackoff(0, 4, time.Hour)
+	login := newLoginTestServer(t, app)
+
+	// Logging in forgets the failures of the account, so that it isn't locked
+	// out by the second wrong password
+	for i := range 2 {
+		if code, _, _ := login("alice@example.com", "wrong"); code != http.StatusUnprocessableEntity {
+			t.Fatalf("wrong password %d: got %d", i+1, code)
+		}
+		if code, _, _ := login("alice@example.com", "pa$$word"); code != http.StatusSeeOther {
+			t.Fatalf("right password %d: got %d", i+1, code)
+		}
+	}
+
+	// The failures of the client aren't forgotten though, so it is blocked
+	// after two more
+	for i := range 2 {
+		if code, _, _ := login("nobody@example.com", "wrong"); code != http.StatusUnprocessableEntity {
+			t.Fatalf("unknown account %d: got %d", i+1, code)
+		}
+	}
+	if code, _, _ := login("bob@example.com", "pa$$word"); code != http.StatusTooManyRequests {
+		t.Errorf("another account from the same client: got %d", code)
+	}
+
+	if n := len(app.mailer.(*testMailer).messages(app)); n != 0 {
+		t.Errorf("got %d emails, want none", n)
+	}
+}
+
+func TestUserLoginRepeated(t *testing.T) {
+	app := newTestApplication(t)
+	app.clientLogins = ratelimit.NewBackoff(20*time.Millisecond, 50, time.Hour)
+	login := newLoginTestServer(t, app)
+
+	if code, _, _ := login("bob@example.com", "wrong"); code != http.StatusUnprocessableEntity {
+		t.Fatalf("wrong password: got %d", code)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	// Once the client has waited after its failure, logging in again and
+	// again, e.g. from another tab, doesn't make it wait anew
+	for i := range 3 {
+		if code, header, _ := login("alice@example.com", "pa$$word"); code != http.StatusSeeOther {
+			t.Errorf("login %d: got %d with Retry-After %q", i+1, code, header.Get("Retry-After"))
+		}
+	}
+}
+
+func TestPasswordResetLogsOut(t *testing.T) {
+	for _, driver := range testDrivers() {
+		t.Run(driver, func(t *testing.T) {
+			app := newTestApplicationFor(t, newTestStorage(t, driver))
+			if err := app.users.Insert("Alice", "alice@example.com", "pa$$word"); err != nil {
+				t.Fatal(err)
+			}
+			if err := app.users.Insert("Bob", "bob@example.com", "pa$$word"); err != nil {
+				t.Fatal(err)
+			}
+			alice, err := app.users.GetByEmail("alice@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			bob, err := app.users.GetByEmail("bob@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Alice and Bob are logged in, and have API tokens
+			logIn := func(email string) *testServer {
+				ts := newTestServer(t, app.routes())
+				code, _, _ := ts.postForm(t, "/user/login", url.Values{"email": {email}, "password": {"pa$$word"}})
+				if code != http.StatusSeeOther {
+					t.Fatalf("logging in as %s: got %d", email, code)
+				}
+				return ts
+			}
+			aliceTS, bobTS := logIn("alice@example.com"), logIn("bob@example.com")
+			for _, id := range []int{alice.ID, bob.ID} {
+				if _, err := app.tokens.Insert(id, "cli", models.ScopeRead, 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			token, err := app.resets.Insert(alice.ID, passwordResetTTL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ts := newTestServer(t, app.routes())
+			code, _, _ := ts.postForm(t, "/user/password/reset/"+token, url.Values{"password": {"new pa$$word"}})
+			if code != http.StatusSeeOther {
+				t.Fatalf("resetting the password: got %d", code)
+			}
+
+			// Only Alice is logged out, and only her tokens are revoked
+			if code, header, _ := aliceTS.get(t, "/user/account"); code != http.StatusSeeOther || header.Get("Location") != "/user/login" {
+				t.Errorf("Alice's account page: got %d to %q", code, header.Get("Location"))
+			}
+			if code, _, _ := bobTS.get(t, "/user/account"); code != http.StatusOK {
+				t.Errorf("Bob's account page: got %d", code)
+			}
+
+			for _, user := range []struct {
+				id   int
+				want int
+			}{{alice.ID, 0}, {bob.ID, 1}} {
+				tokens, err := app.tokens.ForUser(user.id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(tokens) != user.want {
+					t.Errorf("user %d: got %d tokens, want %d", user.id, len(tokens), user.want)
+				}
+			}
+		})
+	}
+}
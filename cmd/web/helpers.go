@@ -4,10 +4,18 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"math"
+	"net"
 	"net/http"
 	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/go-playground/form/v4"
+	"github.com/mgxnch/snippetbox/internal/models"
+	"github.com/mgxnch/snippetbox/internal/syntax"
 )
 
 // serverError is a helper to print the error stack trace and return HTTP 500 to the user.
@@ -26,6 +34,12 @@ func (app *application) notFound(w http.ResponseWriter) {
 	app.clientError(w, http.StatusNotFound)
 }
 
+// gone is a helper to return 410 Gone to the user, for snippets which were
+// deleted after they were first viewed.
+func (app *application) gone(w http.ResponseWriter) {
+	app.clientError(w, http.StatusGone)
+}
+
 // clientError is a helper to return client-related HTTP errors e.g. 400 Bad Request
 func (app *application) clientError(w http.ResponseWriter, status int) {
 	// note(mx): http.Error calls w.Write downstream
@@ -88,6 +102,20 @@ func (app *application) decodePostForm(r *http.Request, dst any) error {
 	return nil
 }
 
+// decodeQuery is the counterpart of decodePostForm for the query string of a
+// GET request.
+func (app *application) decodeQuery(r *http.Request, dst any) error {
+	err := app.formDecoder.Decode(dst, r.URL.Query())
+	if err != nil {
+		var invalidDecoderError *form.InvalidDecoderError
+		if errors.As(err, &invalidDecoderError) {
+			panic(err)
+		}
+		return err
+	}
+	return nil
+}
+
 // isAuthenticated returns true if r.Context() contains isAuthenticatedContextKey
 // that is set to true. Otherwise, this returns false.
 func (app *application) isAuthenticated(r *http.Request) bool {
@@ -98,3 +126,116 @@ func (app *application) isAuthenticated(r *http.Request) bool {
 
 	return isAuthenticated
 }
+
+// isEmailVerified returns true if the user logged in with the session has
+// verified their email address.
+func (app *application) isEmailVerified(r *http.Request) bool {
+	verified, _ := r.Context().Value(emailVerifiedContextKey).(bool)
+	return verified
+}
+
+// authenticatedUserID returns the ID of the logged-in user, or 0 if the
+// request is not authenticated.
+func (app *application) authenticatedUserID(r *http.Request) int {
+	if !app.isAuthenticated(r) {
+		return 0
+	}
+
+	if token := app.requestToken(r); token != nil {
+		return token.UserID
+	}
+
+	return app.sessionManager.GetInt(r.Context(), authUserKey)
+}
+
+// requestToken returns the API token that the request was authenticated with,
+// or nil if it was not authenticated with one.
+func (app *application) requestToken(r *http.Request) *models.Token {
+	token, _ := r.Context().Value(tokenContextKey).(*models.Token)
+	return token
+}
+
+// unlockedSnippetKey is the session key which holds the Unix time until which
+// the password-protected snippet with id stays unlocked.
+func unlockedSnippetKey(id int) string {
+	return fmt.Sprintf("unlockedSnippet:%d", id)
+}
+
+// unlocked returns true if the snippet may be viewed without entering its
+// password, because it has none, it belongs to the logged-in user, or its
+// password was entered in this session a short while ago.
+func (app *application) unlocked(r *http.Request, snippet *models.Snippet) bool {
+	if !snippet.Protected() {
+		return true
+	}
+
+	userID := app.authenticatedUserID(r)
+	if userID != 0 && snippet.UserID == userID {
+		return true
+	}
+
+	until := app.sessionManager.GetInt64(r.Context(), unlockedSnippetKey(snippet.ID))
+	return time.Now().Unix() < until
+}
+
+// clientIP returns the IP address of the client that sent r, without its
+// port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// setRetryAfter sets the Retry-After header of a 429 Too Many Requests
+// response to wait, rounded up to whole seconds.
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
+
+// queryInt returns the value of the query string parameter key as an int, or
+// fallback if the parameter is missing.
+func queryInt(r *http.Request, key string, fallback int) (int, error) {
+	s := r.URL.Query().Get(key)
+	if s == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(s)
+}
+
+// maxFilenameLength is the number of characters that snippetFilename cuts
+// titles down to.
+const maxFilenameLength = 50
+
+// snippetFilename returns the name of the file that a snippet is downloaded
+// as. It is made from the words of the title, joined by hyphens, and has the
+// extension of the snippet's language or format, e.g. "hello-world.go".
+func snippetFilename(s *models.Snippet) string {
+	var name []rune
+	for _, r := range strings.ToLower(s.Title) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			name = append(name, r)
+		case len(name) > 0 && name[len(name)-1] != '-':
+			name = append(name, '-')
+		}
+		if len(name) == maxFilenameLength {
+			break
+		}
+	}
+
+	base := strings.Trim(string(name), "-")
+	if base == "" {
+		base = "snippet-" + s.PublicID
+	}
+
+	switch s.Format {
+	case models.FormatMarkdown:
+		return base + ".md"
+	case models.FormatPlain:
+		return base + ".txt"
+	default:
+		return base + syntax.Extension(s.Language)
+	}
+}
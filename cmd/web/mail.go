@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mgxnch/snippetbox/internal/mailer"
+	"github.com/mgxnch/snippetbox/internal/signer"
+	"github.com/mgxnch/snippetbox/ui"
+)
+
+// newMailer returns the mailer chosen by the -mailer setting.
+func newMailer(cfg *config, infoLog *log.Logger) mailer.Mailer {
+	switch cfg.mail.mailer {
+	case "smtp":
+		return &mailer.SMTP{
+			Addr:     cfg.mail.smtp.addr,
+			Username: cfg.mail.smtp.username,
+			Password: cfg.mail.smtp.password,
+			From:     cfg.mail.from,
+		}
+	case "file":
+		return &mailer.File{Dir: cfg.mail.dir, From: cfg.mail.from}
+	default:
+		infoLog.Print("Using the log mailer; emails and the links in them are written to this log, so use -mailer=smtp in production")
+		return &mailer.Log{Logger: infoLog}
+	}
+}
+
+// newSigner returns a signer with the key of the -signing-key setting, or with
+// a random key if it is empty. Links signed with a random key stop working
+// when the process restarts, and when several processes serve the same
+// users, so it is only meant for local development.
+func newSigner(cfg *config, infoLog *log.Logger) (*signer.Signer, error) {
+	if cfg.signingKey != "" {
+		key, err := hex.DecodeString(cfg.signingKey)
+		if err != nil {
+			return nil, err
+		}
+		return signer.New(key), nil
+	}
+
+	infoLog.Print("No -signing-key set; using a random key, so the links in emails will stop working on restart")
+
+	key := make([]byte, signer.MinKeyLength)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return signer.New(key), nil
+}
+
+// newEmail renders the email template with a name of page for the recipient
+// to. page is the base file path of a *.tmpl file in the "ui/email/" folder,
+// which defines a "subject" and a "body" template.
+func newEmail(to, page string, data any) (mailer.Message, error) {
+	// Emails are plain text, so text/template is used, which doesn't escape
+	// HTML
+	tmpl, err := template.ParseFS(ui.Files, "email/"+page)
+	if err != nil {
+		return mailer.Message{}, err
+	}
+
+	subject := new(bytes.Buffer)
+	if err = tmpl.ExecuteTemplate(subject, "subject", data); err != nil {
+		return mailer.Message{}, err
+	}
+
+	body := new(bytes.Buffer)
+	if err = tmpl.ExecuteTemplate(body, "body", data); err != nil {
+		return mailer.Message{}, err
+	}
+
+	return mailer.Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		Body:    body.String(),
+	}, nil
+}
+
+// humanDuration formats d for the text of emails, e.g. "an hour" or "15
+// minutes", so that they can say how long their links work from the same
+// constants that decide it. Durations which aren't whole minutes fall back to
+// d.String().
+func humanDuration(d time.Duration) string {
+	switch {
+	case d == time.Hour:
+		return "an hour"
+	case d > 0 && d%time.Hour == 0:
+		return fmt.Sprintf("%d hours", d/time.Hour)
+	case d == time.Minute:
+		return "a minute"
+	case d > 0 && d%time.Minute == 0:
+		return fmt.Sprintf("%d minutes", d/time.Minute)
+	default:
+		return d.String()
+	}
+}
+
+// sendEmail renders the email template page for the recipient to and sends it
+// in the background, so that the response doesn't wait for the mail server.
+// Errors are logged rather than returned.
+func (app *application) sendEmail(to, page string, data any) {
+	app.runInBackground(context.Background(), func(context.Context) {
+		msg, err := newEmail(to, page, data)
+		if err == nil {
+			err = app.mailer.Send(msg)
+		}
+		if err != nil {
+			app.errorLog.Printf("sending %s to %s: %s", page, to, err)
+		}
+	})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mgxnch/snippetbox/internal/models"
+)
+
+func TestHumanDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{time.Hour, "an hour"},
+		{48 * time.Hour, "48 hours"},
+		{time.Minute, "a minute"},
+		{15 * time.Minute, "15 minutes"},
+		{90 * time.Minute, "90 minutes"},
+		{90 * time.Second, "1m30s"},
+	}
+
+	for _, tt := range tests {
+		if got := humanDuration(tt.d); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestVerificationEmail(t *testing.T) {
+	app := newTestApplication(t)
+
+	app.sendVerification(&models.User{ID: 1, Name: "Alice", Email: "alice@example.com"})
+
+	msgs := app.mailer.(*testMailer).messages(app)
+	if len(msgs) != 1 {
+		t.Fatalf("got %d emails, want 1", len(msgs))
+	}
+	if want := "open this link within " + humanDuration(verificationTTL) + ":"; !strings.Contains(msgs[0].Body, want) {
+		t.Errorf("body doesn't contain %q:\n%s", want, msgs[0].Body)
+	}
+}
+
+func TestPasswordResetEmail(t *testing.T) {
+	app := newTestApplication(t)
+
+	if err := app.users.Insert("Alice", "alice@example.com", "pa$$word"); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.sendPasswordReset("alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := app.mailer.(*testMailer).messages(app)
+	if len(msgs) != 1 {
+		t.Fatalf("got %d emails, want 1", len(msgs))
+	}
+	if want := "open this link within " + humanDuration(passwordResetTTL) + ":"; !strings.Contains(msgs[0].Body, want) {
+		t.Errorf("body doesn't contain %q:\n%s", want, msgs[0].Body)
+	}
+}
+
+func TestPasswordResetEmailLimit(t *testing.T) {
+	app := newTestApplication(t)
+
+	if err := app.users.Insert("Alice", "alice@example.com", "pa$$word"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Requests sent at once can't all get past the limit before any of them
+	// has counted
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := app.sendPasswordReset("alice@example.com"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := len(app.mailer.(*testMailer).messages(app)); n != 3 {
+		t.Errorf("got %d emails, want 3", n)
+	}
+}
+
+func TestLockoutEmail(t *testing.T) {
+	app := newTestApplication(t)
+
+	if err := app.users.Insert("Alice", "alice@example.com", "pa$$word"); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.sendLockoutNotice("alice@example.com", "127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := app.mailer.(*testMailer).messages(app)
+	if len(msgs) != 1 {
+		t.Fatalf("got %d emails, want 1", len(msgs))
+	}
+	if want := "for the next " + humanDuration(accountLockout) + "."; !strings.Contains(msgs[0].Body, want) {
+		t.Errorf("body doesn't contain %q:\n%s", want, msgs[0].Body)
+	}
+}
@@ -1,48 +1,112 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"database/sql"
 	"flag"
+	"fmt"
 	"html/template"
 	"log"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
-	"github.com/alexedwards/scs/mysqlstore"
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
 	_ "github.com/go-sql-driver/mysql" // import for side-effects only
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/mgxnch/snippetbox/internal/mailer"
 	"github.com/mgxnch/snippetbox/internal/models"
+	"github.com/mgxnch/snippetbox/internal/ratelimit"
+	"github.com/mgxnch/snippetbox/internal/signer"
 )
 
 type application struct {
+	config         *config
 	infoLog        *log.Logger
 	errorLog       *log.Logger
-	snippets       *models.SnippetModel
-	users          *models.UserModel
+	snippets       models.SnippetStore
+	users          models.UserStore
+	tokens         models.TokenStore
+	resets         models.PasswordResetStore
+	twoFactor      models.TwoFactorStore
+	passkeys       models.PasskeyStore
 	templateCache  map[string]*template.Template
 	formDecoder    *form.Decoder // for validating form fields
 	sessionManager *scs.SessionManager
+	snippetGuesses *ratelimit.Limiter // wrong snippet passwords, per snippet
+	clientGuesses  *ratelimit.Limiter // wrong snippet passwords, per client IP address
+	resetEmails    *ratelimit.Limiter // password reset emails, per user
+	verifyEmails   *ratelimit.Limiter // email verification emails, per user
+	codeGuesses    *ratelimit.Limiter // wrong two-factor codes, per user
+	accountLogins  *ratelimit.Backoff // failed logins, per email address
+	clientLogins   *ratelimit.Backoff // failed logins, per client IP address
+	mailer         mailer.Mailer
+	signer         *signer.Signer     // signs the email verification links
+	webAuthn       *webauthn.WebAuthn // checks the passkeys of users
+	background     sync.WaitGroup     // tracks goroutines started by runInBackground
 }
 
 func main() {
-	// Handle environment config values
-	addr := flag.String("addr", ":4000", "HTTP port")
-	dsn := flag.String("dsn", "web:9mfOz8RWTWQSIlgt8hX9jb9V@/snippetbox?parseTime=true", "MySQL data source name")
-	flag.Parse()
-
 	// Initialise loggers
 	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
 	errorLog := log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
 
-	// Initialise DB pool
-	db, err := openDB(*dsn)
+	// Load the config from the command line, the environment and the config file
+	cfg, err := loadConfig(flag.CommandLine, os.Args[1:], os.LookupEnv)
 	if err != nil {
 		errorLog.Fatal(err)
 	}
-	defer db.Close()
+
+	if cfg.printConfig {
+		if err = cfg.print(os.Stdout, flag.CommandLine); err != nil {
+			errorLog.Fatal(err)
+		}
+		return
+	}
+
+	// Initialise the storage backend
+	store, err := openStorage(cfg.db.driver, cfg.db.dsn, cfg.bcryptCost)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	purger := &purger{
+		store:    store,
+		grace:    cfg.purge.grace,
+		archive:  cfg.purge.archive,
+		infoLog:  infoLog,
+		errorLog: errorLog,
+	}
+
+	// Run a command instead of the server, e.g. "migrate up"
+	if args := flag.Args(); len(args) > 0 {
+		switch args[0] {
+		case "migrate":
+			err = runMigrate(store, infoLog, args[1:])
+		case "purge":
+			err = purger.purge()
+		default:
+			err = fmt.Errorf("unknown command %q", args[0])
+		}
+		store.Close()
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		return
+	}
+
+	if cfg.db.autoMigrate && store.db != nil {
+		migrator, err := store.migrator()
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		if err = migrateUp(migrator, infoLog); err != nil {
+			errorLog.Fatal(err)
+		}
+	}
 
 	// Set up the template cache
 	templateCache, err := newTemplateCache()
@@ -53,24 +117,49 @@ func main() {
 	// Set up a decoder instance
 	formDecoder := form.NewDecoder()
 
+	// Set up the signer of the links in emails
+	linkSigner, err := newSigner(cfg, infoLog)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	// Set up the relying party of passkeys
+	webAuthn, err := newWebAuthn(cfg)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
 	// Set up session manager
 	sessionManager := scs.New()
-	sessionManager.Store = mysqlstore.New(db)
-	sessionManager.Lifetime = 12 * time.Hour
+	sessionManager.Store = store.sessions
+	sessionManager.Lifetime = cfg.sessionLifetime
 
 	// Set up application struct
-	app := application{
-		infoLog:  infoLog,
-		errorLog: errorLog,
-		snippets: &models.SnippetModel{
-			DB: db,
-		},
-		users: &models.UserModel{
-			DB: db,
-		},
+	app := &application{
+		config:         cfg,
+		infoLog:        infoLog,
+		errorLog:       errorLog,
+		snippets:       store.snippets,
+		users:          store.users,
+		tokens:         store.tokens,
+		resets:         store.resets,
+		twoFactor:      store.twoFactor,
+		passkeys:       store.passkeys,
 		templateCache:  templateCache,
 		formDecoder:    formDecoder,
 		sessionManager: sessionManager,
+		// Wrong snippet passwords are limited per snippet, against guesses
+		// from many clients, and per client, against guesses at many snippets
+		snippetGuesses: ratelimit.New(20, time.Hour),
+		clientGuesses:  ratelimit.New(10, 15*time.Minute),
+		resetEmails:    ratelimit.New(3, time.Hour),
+		verifyEmails:   ratelimit.New(3, time.Hour),
+		codeGuesses:    ratelimit.New(5, 15*time.Minute),
+		accountLogins:  ratelimit.NewBackoff(time.Second, 10, accountLockout),
+		clientLogins:   ratelimit.NewBackoff(100*time.Millisecond, 50, time.Hour),
+		mailer:         newMailer(cfg, infoLog),
+		signer:         linkSigner,
+		webAuthn:       webAuthn,
 	}
 
 	// Set up non-default TLS settings. We are using these two with assembly implementations
@@ -82,17 +171,41 @@ func main() {
 
 	// Create HTTP server struct
 	srv := &http.Server{
-		Addr:         *addr,
+		Addr:         cfg.addr,
 		ErrorLog:     errorLog,
 		Handler:      app.routes(),
 		TLSConfig:    tlsConfig,
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  cfg.timeouts.idle,
+		ReadTimeout:  cfg.timeouts.read,
+		WriteTimeout: cfg.timeouts.write,
+	}
+
+	// Start the background jobs. They are stopped once the server has stopped,
+	// so that requests which are still being served can rely on them.
+	ctx, stopBackground := context.WithCancel(context.Background())
+	if cfg.purge.interval > 0 {
+		app.runInBackground(ctx, func(ctx context.Context) {
+			purger.run(ctx, cfg.purge.interval)
+		})
+	}
+
+	err = app.serve(srv, cfg.tls.certFile, cfg.tls.keyFile, cfg.timeouts.shutdown)
+
+	infoLog.Print("Waiting for background jobs to finish")
+	stopBackground()
+	app.background.Wait()
+
+	infoLog.Print("Closing storage")
+	if closeErr := store.Close(); closeErr != nil {
+		errorLog.Print(closeErr)
+	}
+
+	// Exit with a non-zero status if the server failed to start or didn't
+	// shut down cleanly, so that process supervisors can tell
+	if err != nil {
+		errorLog.Fatal(err)
 	}
-	infoLog.Printf("Starting server on http://localhost%s", *addr)
-	err = srv.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem")
-	errorLog.Fatal(err)
+	infoLog.Print("Server stopped")
 }
 
 // openDB opens a connection to the database and verifies that a connection can be established.
@@ -2,17 +2,25 @@ package main
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/justinas/nosurf"
+	"github.com/mgxnch/snippetbox/internal/models"
 )
 
 // secureHeaders is a middleware that sets security-related headers
 // into the HTTP response in accordance with OWASP best practices.
-func secureHeaders(next http.Handler) http.Handler {
+func (app *application) secureHeaders(next http.Handler) http.Handler {
 	// Standard middleware convention
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Security-Policy", "default-src 'self'; style-src: 'self' fonts.googleapis.com; font-src fonts.gstatic.com")
+		if app.config.csp != "" {
+			w.Header().Set("Content-Security-Policy", app.config.csp)
+		}
 		w.Header().Set("Referrer-Policy", "origin-when-cross-origin")
 		w.Header().Set("X-Content-Type-Options", "nosniff")
 		w.Header().Set("X-Frame-Options", "deny")
@@ -38,9 +46,11 @@ func noSurf(next http.Handler) http.Handler {
 	return csrfHandler
 }
 
-// requireAuthentication is a middleware that checks if a user is allowed to
-// access a certain page.
-func (app *application) requireAuthentication(next http.Handler) http.Handler {
+// requireLogin is a middleware that checks if a user is logged in, whether or
+// not they have verified their email address. Only the few pages that users
+// need before they verify it use it directly, while the others use
+// requireAuthentication.
+func (app *application) requireLogin(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !app.isAuthenticated(r) {
 			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
@@ -56,11 +66,35 @@ func (app *application) requireAuthentication(next http.Handler) http.Handler {
 	})
 }
 
+// requireAuthentication is a middleware that checks if a user is allowed to
+// access a certain page. Users must be logged in, and must have verified their
+// email address, so that nobody can create snippets under an address that
+// isn't theirs. Unverified users are sent to their account page, where they
+// can ask for another verification link.
+func (app *application) requireAuthentication(next http.Handler) http.Handler {
+	return app.requireLogin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.isEmailVerified(r) {
+			app.sessionManager.Put(r.Context(), "flash", "Please verify your email address first, with the link that we emailed you.")
+			http.Redirect(w, r, "/user/account", http.StatusSeeOther)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}))
+}
+
 // authenticate is a middleware that checks if a userID exists within the context.
 // If a valid userID exists, the context is set with the isAuthenticatedContextKey
-// key with a value of true.
+// key with a value of true, and the emailVerifiedContextKey key with whether
+// the user has verified their email address.
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The request has already been authenticated with an API token
+		if app.isAuthenticated(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		id := app.sessionManager.GetInt(r.Context(), authUserKey)
 		if id == 0 {
 			next.ServeHTTP(w, r)
@@ -68,17 +102,121 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		}
 
 		// Check DB to see if userID exists
-		exists, err := app.users.Exists(id)
-		if err != nil {
+		user, err := app.users.Get(id)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
 			app.serverError(w, err)
 			return
 		}
 
-		if exists {
+		if err == nil {
 			ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+			ctx = context.WithValue(ctx, emailVerifiedContextKey, user.EmailVerified)
 			r = r.WithContext(ctx)
 		}
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+// authenticateToken is a middleware that authenticates requests carrying an
+// "Authorization: Bearer <token>" header. A valid token sets the context with
+// the isAuthenticatedContextKey key and the token itself, which also exempts
+// the request from CSRF checks as it doesn't rely on cookies. Requests
+// without the header are passed on untouched, so that app.authenticate can
+// check the session instead.
+func (app *application) authenticateToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		plaintext, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || plaintext == "" {
+			app.apiInvalidToken(w)
+			return
+		}
+
+		token, err := app.tokens.Authenticate(plaintext)
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidCredentials) {
+				app.apiInvalidToken(w)
+			} else {
+				app.apiServerError(w, err)
+			}
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+		ctx = context.WithValue(ctx, tokenContextKey, token)
+		r = r.WithContext(ctx)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireWriteScope is a middleware that refuses requests authenticated with
+// a read-only API token. Session-authenticated requests are let through.
+func (app *application) requireWriteScope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := app.requestToken(r); token != nil && !token.CanWrite() {
+			app.apiClientError(w, http.StatusForbidden, "this token only has the read scope")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// redirectLegacyID is a middleware that permanently redirects URLs which refer
+// to a snippet by the integer ID in their {id} parameter to the same URL with
+// the snippet's public ID. Only snippets created before public IDs existed are
+// redirected, so that newer snippets can't be found by counting up. It must
+// come after app.authenticate in the middleware chain.
+func (app *application) redirectLegacyID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		param := chi.URLParam(r, "id")
+
+		// Public IDs and slugs never parse as integers
+		id, err := strconv.Atoi(param)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		api := strings.HasPrefix(r.URL.Path, "/api/")
+
+		snippet, err := app.snippets.Get(id, app.authenticatedUserID(r))
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			if api {
+				app.apiServerError(w, err)
+			} else {
+				app.serverError(w, err)
+			}
+			return
+		}
+		if err != nil || !snippet.Legacy {
+			if api {
+				app.apiNotFound(w)
+			} else {
+				app.notFound(w)
+			}
+			return
+		}
+
+		segments := strings.Split(r.URL.Path, "/")
+		segments[slices.Index(segments, param)] = snippet.Ref()
+
+		u := *r.URL
+		u.Path = strings.Join(segments, "/")
+		u.RawPath = ""
+
+		// 308 keeps the method and body of the request, unlike 301
+		status := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			status = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, u.String(), status)
+	})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/mgxnch/snippetbox/internal/migrate"
+)
+
+// migrateUsage describes the arguments of the migrate command.
+const migrateUsage = "usage: migrate up|down|status|force VERSION"
+
+// runMigrate implements the "migrate" command, which manages the schema of the
+// storage backend. args are the command-line arguments after "migrate".
+func runMigrate(store *storage, infoLog *log.Logger, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	migrator, err := store.migrator()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		return migrateUp(migrator, infoLog)
+	case "down":
+		migration, err := migrator.Down()
+		if err != nil {
+			if errors.Is(err, migrate.ErrNoChange) {
+				infoLog.Print("No migrations to roll back")
+				return nil
+			}
+			return err
+		}
+		infoLog.Printf("Rolled back %s", migration)
+		return nil
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			if s.Applied {
+				infoLog.Printf("%s\tapplied %s", s.Migration, humanDate(s.AppliedAt))
+			} else {
+				infoLog.Printf("%s\tpending", s.Migration)
+			}
+		}
+		return nil
+	case "force":
+		if len(args) != 2 {
+			return errors.New(migrateUsage)
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil || version < 0 {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		if err = migrator.Force(version); err != nil {
+			return err
+		}
+		infoLog.Printf("Recorded migrations up to version %d as applied", version)
+		return nil
+	default:
+		return errors.New(migrateUsage)
+	}
+}
+
+// migrateUp applies every pending migration and logs each one.
+func migrateUp(migrator *migrate.Migrator, infoLog *log.Logger) error {
+	applied, err := migrator.Up()
+	for _, migration := range applied {
+		infoLog.Printf("Applied %s", migration)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(applied) == 0 {
+		infoLog.Print("Schema is up to date")
+	}
+	return nil
+}
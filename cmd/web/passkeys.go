@@ -0,0 +1,473 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/mgxnch/snippetbox/internal/models"
+	"github.com/mgxnch/snippetbox/internal/validator"
+)
+
+// Session keys of passkeys. Each holds a JSON-encoded webauthn.SessionData,
+// with the challenge that the browser's response must sign.
+const (
+	passkeyRegistrationKey = "passkeyRegistration" // a passkey being added by the logged-in user
+	passkeyLoginKey        = "passkeyLogin"        // a login with a passkey
+)
+
+// newWebAuthn returns the WebAuthn relying party of the application, whose
+// passkeys are tied to the host of the base URL, and only work on pages
+// served from it.
+//
+// Passkeys must verify the user, e.g. with a PIN or fingerprint, so that they
+// are a second factor of their own, and users who have turned on two-factor
+// authentication aren't asked for a code as well.
+func newWebAuthn(cfg *config) (*webauthn.WebAuthn, error) {
+	u, err := url.Parse(cfg.baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	wa := &webauthn.Config{
+		RPID:          u.Hostname(),
+		RPDisplayName: totpIssuer,
+		RPOrigins:     []string{u.Scheme + "://" + u.Host},
+		// Discoverable credentials let users log in without typing their
+		// email address first
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:        protocol.ResidentKeyRequirementRequired,
+			RequireResidentKey: protocol.ResidentKeyRequired(),
+			UserVerification:   protocol.VerificationRequired,
+		},
+		AttestationPreference: protocol.PreferNoAttestation,
+	}
+	wa.Timeouts.Login.Enforce = true
+	wa.Timeouts.Registration.Enforce = true
+
+	return webauthn.New(wa)
+}
+
+// passkeyUser adapts a user and their passkeys to webauthn.User.
+type passkeyUser struct {
+	user     *models.User
+	passkeys []*models.Passkey
+}
+
+// userHandle returns the WebAuthn user handle of the user with id, which
+// authenticators store with their passkeys and hand back when logging in.
+func userHandle(id int) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(id))
+}
+
+// userIDFromHandle returns the ID of the user with the given user handle, or
+// false if it isn't one of ours.
+func userIDFromHandle(handle []byte) (int, bool) {
+	if len(handle) != 8 {
+		return 0, false
+	}
+	id := binary.BigEndian.Uint64(handle)
+	if id < 1 || id > uint64(^uint(0)>>1) {
+		return 0, false
+	}
+	return int(id), true
+}
+
+func (u *passkeyUser) WebAuthnID() []byte {
+	return userHandle(u.user.ID)
+}
+
+func (u *passkeyUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *passkeyUser) WebAuthnDisplayName() string {
+	return u.user.Name
+}
+
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, len(u.passkeys))
+	for i, p := range u.passkeys {
+		var transports []protocol.AuthenticatorTransport
+		if p.Transports != "" {
+			for _, t := range strings.Split(p.Transports, ",") {
+				transports = append(transports, protocol.AuthenticatorTransport(t))
+			}
+		}
+
+		credentials[i] = webauthn.Credential{
+			ID:        p.CredentialID,
+			PublicKey: p.PublicKey,
+			Transport: transports,
+			Flags:     webauthn.CredentialFlags{BackupEligible: p.BackupEligible},
+			Authenticator: webauthn.Authenticator{
+				SignCount: p.SignCount,
+			},
+		}
+	}
+	return credentials
+}
+
+// passkey returns the passkey of u with the given credential ID, or nil if
+// there is none.
+func (u *passkeyUser) passkey(credentialID []byte) *models.Passkey {
+	for _, p := range u.passkeys {
+		if bytes.Equal(p.CredentialID, credentialID) {
+			return p
+		}
+	}
+	return nil
+}
+
+// passkeyUserByID fetches the user with id and their passkeys.
+func (app *application) passkeyUserByID(id int) (*passkeyUser, error) {
+	user, err := app.users.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	passkeys, err := app.passkeys.ForUser(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &passkeyUser{user: user, passkeys: passkeys}, nil
+}
+
+// putWebAuthnSession keeps the data of a ceremony that has just begun in the
+// session under key, until the browser responds.
+func (app *application) putWebAuthnSession(r *http.Request, key string, session *webauthn.SessionData) error {
+	js, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	app.sessionManager.Put(r.Context(), key, js)
+	return nil
+}
+
+// popWebAuthnSession returns and removes the data of the ceremony under key,
+// so that each challenge can only be answered once. It returns false if no
+// ceremony was begun.
+func (app *application) popWebAuthnSession(r *http.Request, key string) (webauthn.SessionData, bool) {
+	var session webauthn.SessionData
+
+	js := app.sessionManager.PopBytes(r.Context(), key)
+	if js == nil || json.Unmarshal(js, &session) != nil {
+		return session, false
+	}
+	return session, true
+}
+
+// passkeyResponse is the JSON response to the end of a ceremony, which tells
+// the browser where to go next.
+type passkeyResponse struct {
+	Redirect string `json:"redirect"`
+}
+
+// passkeyAddInput is the JSON body of passkeyAddFinish.
+type passkeyAddInput struct {
+	Name       string          `json:"name"`
+	Credential json.RawMessage `json:"credential"` // the PublicKeyCredential made by the authenticator
+}
+
+// passkeyAddBegin responds with the options of
+// navigator.credentials.create() for a new passkey of the logged-in user.
+func (app *application) passkeyAddBegin(w http.ResponseWriter, r *http.Request) {
+	u, err := app.passkeyUserByID(app.authenticatedUserID(r))
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	// Authenticators that already hold one of the user's passkeys refuse to
+	// add another
+	creation, session, err := app.webAuthn.BeginRegistration(u,
+		webauthn.WithExclusions(webauthn.Credentials(u.WebAuthnCredentials()).CredentialDescriptors()))
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	if err = app.putWebAuthnSession(r, passkeyRegistrationKey, session); err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, creation)
+}
+
+// passkeyAddFinish checks the new passkey made by the authenticator in
+// response to passkeyAddBegin, and adds it to the logged-in user.
+func (app *application) passkeyAddFinish(w http.ResponseWriter, r *http.Request) {
+	var input passkeyAddInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.apiClientError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var v validator.Validator
+	v.CheckField(validator.NotBlank(input.Name), "name", "This field cannot be blank")
+	v.CheckField(validator.MaxChars(input.Name, 100), "name", "This field cannot be more than 100 characters long")
+
+	if !v.Valid() {
+		app.apiValidationError(w, v)
+		return
+	}
+
+	session, ok := app.popWebAuthnSession(r, passkeyRegistrationKey)
+	if !ok {
+		app.apiClientError(w, http.StatusBadRequest, "no passkey is being added, or it took too long")
+		return
+	}
+
+	u, err := app.passkeyUserByID(app.authenticatedUserID(r))
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(input.Credential)
+	if err != nil {
+		app.apiClientError(w, http.StatusBadRequest, "the passkey could not be read")
+		return
+	}
+
+	credential, err := app.webAuthn.CreateCredential(u, session, parsed)
+	if err != nil {
+		app.apiClientError(w, http.StatusBadRequest, "the passkey could not be verified")
+		return
+	}
+
+	transports := make([]string, len(credential.Transport))
+	for i, t := range credential.Transport {
+		transports[i] = string(t)
+	}
+
+	_, err = app.passkeys.Insert(&models.Passkey{
+		UserID:         u.user.ID,
+		Name:           input.Name,
+		CredentialID:   credential.ID,
+		PublicKey:      credential.PublicKey,
+		SignCount:      credential.Authenticator.SignCount,
+		BackupEligible: credential.Flags.BackupEligible,
+		Transports:     strings.Join(transports, ","),
+	})
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateCredential) {
+			app.apiClientError(w, http.StatusConflict, "this passkey has already been added")
+			return
+		}
+		app.apiServerError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Passkey added successfully. You can now use it to log in.")
+	app.writeJSON(w, http.StatusCreated, passkeyResponse{Redirect: "/user/account"})
+}
+
+// passkeyLoginBegin responds with the options of navigator.credentials.get()
+// for a login with a passkey. No user is given, so the browser offers every
+// passkey that it has for the site.
+func (app *application) passkeyLoginBegin(w http.ResponseWriter, r *http.Request) {
+	assertion, session, err := app.webAuthn.BeginDiscoverableLogin()
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	if err = app.putWebAuthnSession(r, passkeyLoginKey, session); err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, assertion)
+}
+
+// passkeyLoginFinish checks the signature made by the authenticator in
+// response to passkeyLoginBegin, and logs in the owner of the passkey.
+func (app *application) passkeyLoginFinish(w http.ResponseWriter, r *http.Request) {
+	session, ok := app.popWebAuthnSession(r, passkeyLoginKey)
+	if !ok {
+		app.apiClientError(w, http.StatusBadRequest, "no login with a passkey has begun, or it took too long")
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(http.MaxBytesReader(w, r.Body, maxJSONBytes))
+	if err != nil {
+		app.apiClientError(w, http.StatusBadRequest, "the passkey could not be read")
+		return
+	}
+
+	// The user is looked up by the user handle that the authenticator stored
+	// with the passkey. Handles of deleted users aren't an error of ours.
+	var u *passkeyUser
+	var lookupErr error
+	findUser := func(rawID, handle []byte) (webauthn.User, error) {
+		id, ok := userIDFromHandle(handle)
+		if !ok {
+			return nil, models.ErrNoRecord
+		}
+		found, err := app.passkeyUserByID(id)
+		if err != nil {
+			if !errors.Is(err, models.ErrNoRecord) {
+				lookupErr = err
+			}
+			return nil, err
+		}
+		u = found
+		return u, nil
+	}
+
+	_, credential, err := app.webAuthn.ValidatePasskeyLogin(findUser, session, parsed)
+	if lookupErr != nil {
+		app.apiServerError(w, lookupErr)
+		return
+	}
+	if err != nil {
+		// Revoked passkeys end up here too
+		app.apiClientError(w, http.StatusUnauthorized, "the passkey is not valid")
+		return
+	}
+
+	// A counter that hasn't gone up means that the passkey may have been
+	// cloned, and a login that has already used the same counter is refused
+	// too, in case two of them race
+	passkey := u.passkey(credential.ID)
+	err = app.passkeys.Use(passkey.ID, credential.Authenticator.SignCount)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			app.apiClientError(w, http.StatusUnauthorized, "the passkey is not valid")
+			return
+		}
+		app.apiServerError(w, err)
+		return
+	}
+
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	// A passkey stands in for both the password and the two-factor code
+	app.sessionManager.Remove(r.Context(), twoFactorUserKey)
+	app.sessionManager.Remove(r.Context(), twoFactorExpiresKey)
+	app.sessionManager.Put(r.Context(), authUserKey, u.user.ID)
+
+	app.writeJSON(w, http.StatusOK, passkeyResponse{Redirect: "/snippet/create"})
+}
+
+// passkeyRenameForm holds the new name of a passkey.
+type passkeyRenameForm struct {
+	Name                string `form:"name"`
+	validator.Validator `form:"-"`
+}
+
+// ownedPasskey fetches the passkey whose ID is in the URL, if it belongs to
+// the logged-in user. Otherwise it responds with 404 and returns false.
+func (app *application) ownedPasskey(w http.ResponseWriter, r *http.Request) (passkey *models.Passkey, ok bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return nil, false
+	}
+
+	passkeys, err := app.passkeys.ForUser(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return nil, false
+	}
+
+	for _, p := range passkeys {
+		if p.ID == id {
+			return p, true
+		}
+	}
+
+	// Passkeys of other users are treated as if they don't exist
+	app.notFound(w)
+	return nil, false
+}
+
+func (app *application) passkeyRename(w http.ResponseWriter, r *http.Request) {
+	passkey, ok := app.ownedPasskey(w, r)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Passkey = passkey
+	data.Form = passkeyRenameForm{Name: passkey.Name}
+	app.render(w, http.StatusOK, "passkey_rename.tmpl", data)
+}
+
+func (app *application) passkeyRenamePost(w http.ResponseWriter, r *http.Request) {
+	passkey, ok := app.ownedPasskey(w, r)
+	if !ok {
+		return
+	}
+
+	var form passkeyRenameForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Name, 100), "name", "This field cannot be more than 100 characters long")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Passkey = passkey
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "passkey_rename.tmpl", data)
+		return
+	}
+
+	err = app.passkeys.Rename(passkey.ID, passkey.UserID, form.Name)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Passkey renamed successfully")
+	http.Redirect(w, r, "/user/account", http.StatusSeeOther)
+}
+
+func (app *application) passkeyRevokePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	// Passkeys of other users are treated as if they don't exist
+	err = app.passkeys.Revoke(id, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Passkey revoked successfully. Remember to also delete it from your authenticator.")
+	http.Redirect(w, r, "/user/account", http.StatusSeeOther)
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// softAuthenticator is a WebAuthn authenticator in software, which plays the
+// part of both the browser and the security key. It holds a single passkey,
+// and always verifies the user.
+type softAuthenticator struct {
+	origin       string
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T, origin string) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credentialID := make([]byte, 16)
+	if _, err = rand.Read(credentialID); err != nil {
+		t.Fatal(err)
+	}
+
+	return &softAuthenticator{origin: origin, key: key, credentialID: credentialID}
+}
+
+// Flags of authenticator data.
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+var b64 = base64.RawURLEncoding
+
+// ceremonyOptions holds the fields of the options of
+// navigator.credentials.create() and get() that the authenticator uses.
+type ceremonyOptions struct {
+	PublicKey struct {
+		Challenge string `json:"challenge"`
+		RPID      string `json:"rpId"`
+		RP        struct {
+			ID string `json:"id"`
+		} `json:"rp"`
+		User struct {
+			ID string `json:"id"`
+		} `json:"user"`
+	} `json:"publicKey"`
+}
+
+// clientData returns the clientDataJSON that a browser would make for a
+// ceremony of type typ with the given challenge.
+func (a *softAuthenticator) clientData(typ, challenge string) []byte {
+	js, _ := json.Marshal(map[string]any{
+		"type":        typ,
+		"challenge":   challenge,
+		"origin":      a.origin,
+		"crossOrigin": false,
+	})
+	return js
+}
+
+// authData returns authenticator data for rpID with the given flags, followed
+// by attested.
+func (a *softAuthenticator) authData(rpID string, flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attested...)
+}
+
+// create makes a new passkey in response to the options of
+// passkeyAddBegin, and returns the PublicKeyCredential that the browser
+// would send.
+func (a *softAuthenticator) create(t *testing.T, optionsJSON string) json.RawMessage {
+	t.Helper()
+
+	var options ceremonyOptions
+	if err := json.Unmarshal([]byte(optionsJSON), &options); err != nil {
+		t.Fatal(err)
+	}
+
+	userHandle, err := b64.DecodeString(options.PublicKey.User.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.userHandle = userHandle
+
+	// The public key as a COSE_Key: EC2 key type, ES256 and the P-256 curve
+	x, y := make([]byte, 32), make([]byte, 32)
+	a.key.X.FillBytes(x)
+	a.key.Y.FillBytes(y)
+	publicKey, err := cbor.Marshal(map[int]any{1: 2, 3: -7, -1: 1, -2: x, -3: y})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attested := make([]byte, 16) // the AAGUID, all zeros for no attestation
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, publicKey...)
+
+	attestationObject, err := cbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": a.authData(options.PublicKey.RP.ID, flagUserPresent|flagUserVerified|flagAttestedData, attested),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	js, err := json.Marshal(map[string]any{
+		"id":    b64.EncodeToString(a.credentialID),
+		"rawId": b64.EncodeToString(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    b64.EncodeToString(a.clientData("webauthn.create", options.PublicKey.Challenge)),
+			"attestationObject": b64.EncodeToString(attestationObject),
+			"transports":        []string{"usb"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return js
+}
+
+// get signs the challenge of the options of passkeyLoginBegin with the
+// passkey, and returns the PublicKeyCredential that the browser would send.
+func (a *softAuthenticator) get(t *testing.T, optionsJSON string) []byte {
+	t.Helper()
+
+	var options ceremonyOptions
+	if err := json.Unmarshal([]byte(optionsJSON), &options); err != nil {
+		t.Fatal(err)
+	}
+
+	a.signCount++
+	authData := a.authData(options.PublicKey.RPID, flagUserPresent|flagUserVerified, nil)
+	clientData := a.clientData("webauthn.get", options.PublicKey.Challenge)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	js, err := json.Marshal(map[string]any{
+		"id":    b64.EncodeToString(a.credentialID),
+		"rawId": b64.EncodeToString(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    b64.EncodeToString(clientData),
+			"authenticatorData": b64.EncodeToString(authData),
+			"signature":         b64.EncodeToString(signature),
+			"userHandle":        b64.EncodeToString(a.userHandle),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return js
+}
+
+// newPasskeyUser signs up a user with a verified email address, and logs them
+// in on a new test server with their password.
+func newPasskeyUser(t *testing.T, app *application, name, email string) *testServer {
+	t.Helper()
+
+	if err := app.users.Insert(name, email, "pa$$word"); err != nil {
+		t.Fatal(err)
+	}
+	user, err := app.users.GetByEmail(email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = app.users.VerifyEmail(user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := newTestServer(t, app.routes())
+
+	code, header, _ := ts.postForm(t, "/user/login", url.Values{"email": {email}, "password": {"pa$$word"}})
+	if code != http.StatusSeeOther || header.Get("Location") != "/snippet/create" {
+		t.Fatalf("logging in: got %d to %q", code, header.Get("Location"))
+	}
+
+	return ts
+}
+
+// addPasskey adds the passkey of a to the user logged in on ts.
+func addPasskey(t *testing.T, ts *testServer, a *softAuthenticator, name string) {
+	t.Helper()
+
+	code, _, body := ts.postJSON(t, "/user/passkeys/add/begin", nil)
+	if code != http.StatusOK {
+		t.Fatalf("beginning to add the passkey: got %d: %s", code, body)
+	}
+
+	input, _ := json.Marshal(passkeyAddInput{Name: name, Credential: a.create(t, body)})
+	code, _, body = ts.postJSON(t, "/user/passkeys/add/finish", input)
+	if code != http.StatusCreated {
+		t.Fatalf("finishing adding the passkey: got %d: %s", code, body)
+	}
+}
+
+// loginWithPasskey logs in on ts with the passkey of a, and returns the status
+// code and body of the response to the end of the ceremony.
+func loginWithPasskey(t *testing.T, ts *testServer, a *softAuthenticator) (int, string) {
+	t.Helper()
+
+	code, _, body := ts.postJSON(t, "/user/passkeys/login/begin", nil)
+	if code != http.StatusOK {
+		t.Fatalf("beginning login: got %d: %s", code, body)
+	}
+
+	code, _, body = ts.postJSON(t, "/user/passkeys/login/finish", a.get(t, body))
+	return code, body
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	app := newTestApplication(t)
+	alice := newPasskeyUser(t, app, "Alice", "alice@example.com")
+
+	a := newSoftAuthenticator(t, "https://snippetbox.test")
+	addPasskey(t, alice, a, "Security key")
+
+	passkeys, err := app.passkeys.ForUser(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(passkeys) != 1 || passkeys[0].Name != "Security key" || passkeys[0].Transports != "usb" {
+		t.Fatalf("got passkeys %+v; want one named Security key", passkeys)
+	}
+
+	// A browser that has never logged in
+	ts := newTestServer(t, app.routes())
+
+	code, body := loginWithPasskey(t, ts, a)
+	if code != http.StatusOK || !strings.Contains(body, `"redirect": "/snippet/create"`) {
+		t.Fatalf("got %d: %s; want 200 with a redirect", code, body)
+	}
+
+	code, _, body = ts.get(t, "/user/account")
+	if code != http.StatusOK || !strings.Contains(body, "Security key") {
+		t.Errorf("account page: got %d; want 200 with the passkey", code)
+	}
+
+	passkeys, err = app.passkeys.ForUser(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if passkeys[0].SignCount != 1 || passkeys[0].LastUsed.IsZero() {
+		t.Errorf("got sign count %d and last used %v; want 1 and a time", passkeys[0].SignCount, passkeys[0].LastUsed)
+	}
+}
+
+func TestPasskeyLoginRejected(t *testing.T) {
+	app := newTestApplication(t)
+	alice := newPasskeyUser(t, app, "Alice", "alice@example.com")
+
+	a := newSoftAuthenticator(t, "https://snippetbox.test")
+	addPasskey(t, alice, a, "Security key")
+
+	tests := []struct {
+		name  string
+		login func(t *testing.T, ts *testServer) int
+	}{
+		{
+			name: "Replayed response",
+			login: func(t *testing.T, ts *testServer) int {
+				// The response is intercepted from Alice's own login
+				victim := newTestServer(t, app.routes())
+				_, _, options := victim.postJSON(t, "/user/passkeys/login/begin", nil)
+				response := a.get(t, options)
+				if code, _, body := victim.postJSON(t, "/user/passkeys/login/finish", response); code != http.StatusOK {
+					t.Fatalf("Alice's login: got %d: %s", code, body)
+				}
+
+				ts.postJSON(t, "/user/passkeys/login/begin", nil)
+				code, _, _ := ts.postJSON(t, "/user/passkeys/login/finish", response)
+				return code
+			},
+		},
+		{
+			name: "Old challenge",
+			login: func(t *testing.T, ts *testServer) int {
+				_, _, old := ts.postJSON(t, "/user/passkeys/login/begin", nil)
+				ts.postJSON(t, "/user/passkeys/login/begin", nil)
+				code, _, _ := ts.postJSON(t, "/user/passkeys/login/finish", a.get(t, old))
+				return code
+			},
+		},
+		{
+			name: "Wrong origin",
+			login: func(t *testing.T, ts *testServer) int {
+				phished := *a
+				phished.origin = "https://snippetbox.example"
+				code, _ := loginWithPasskey(t, ts, &phished)
+				return code
+			},
+		},
+		{
+			name: "Cloned authenticator",
+			login: func(t *testing.T, ts *testServer) int {
+				clone := *a
+				clone.signCount = 0
+				code, _ := loginWithPasskey(t, ts, &clone)
+				return code
+			},
+		},
+		{
+			name: "Unknown passkey",
+			login: func(t *testing.T, ts *testServer) int {
+				other := newSoftAuthenticator(t, "https://snippetbox.test")
+				other.userHandle = a.userHandle
+				code, _ := loginWithPasskey(t, ts, other)
+				return code
+			},
+		},
+		{
+			name: "Unknown user",
+			login: func(t *testing.T, ts *testServer) int {
+				other := *a
+				other.userHandle = userHandle(99)
+				code, _ := loginWithPasskey(t, ts, &other)
+				return code
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, app.routes())
+
+			code := tt.login(t, ts)
+			if code != http.StatusUnauthorized && code != http.StatusBadRequest {
+				t.Errorf("got %d; want 400 or 401", code)
+			}
+
+			if code, _, _ := ts.get(t, "/user/account"); code != http.StatusSeeOther {
+				t.Errorf("account page: got %d; want a redirect to the login page", code)
+			}
+		})
+	}
+}
+
+func TestPasskeyManagement(t *testing.T) {
+	app := newTestApplication(t)
+	alice := newPasskeyUser(t, app, "Alice", "alice@example.com")
+	bob := newPasskeyUser(t, app, "Bob", "bob@example.com")
+
+	laptop := newSoftAuthenticator(t, "https://snippetbox.test")
+	phone := newSoftAuthenticator(t, "https://snippetbox.test")
+	addPasskey(t, alice, laptop, "Laptop")
+	addPasskey(t, alice, phone, "Phone")
+
+	// The same authenticator can't be added twice
+	code, _, body := alice.postJSON(t, "/user/passkeys/add/begin", nil)
+	if !strings.Contains(body, b64.EncodeToString(laptop.credentialID)) {
+		t.Errorf("got %d: %s; want the existing passkeys to be excluded", code, body)
+	}
+	input, _ := json.Marshal(passkeyAddInput{Name: "Laptop again", Credential: laptop.create(t, body)})
+	if code, _, _ = alice.postJSON(t, "/user/passkeys/add/finish", input); code != http.StatusConflict {
+		t.Errorf("adding a passkey twice: got %d; want 409", code)
+	}
+
+	// Bob can neither rename nor revoke Alice's passkeys
+	if code, _, _ = bob.postForm(t, "/user/passkeys/rename/1", url.Values{"name": {"Mine"}}); code != http.StatusNotFound {
+		t.Errorf("renaming another user's passkey: got %d; want 404", code)
+	}
+	if code, _, _ = bob.postForm(t, "/user/passkeys/revoke/1", url.Values{}); code != http.StatusNotFound {
+		t.Errorf("revoking another user's passkey: got %d; want 404", code)
+	}
+
+	if code, _, _ = alice.postForm(t, "/user/passkeys/rename/1", url.Values{"name": {""}}); code != http.StatusUnprocessableEntity {
+		t.Errorf("blank name: got %d; want 422", code)
+	}
+	if code, _, _ = alice.postForm(t, "/user/passkeys/rename/1", url.Values{"name": {"Work laptop"}}); code != http.StatusSeeOther {
+		t.Errorf("renaming: got %d; want 303", code)
+	}
+	if code, _, _ = alice.postForm(t, "/user/passkeys/revoke/2", url.Values{}); code != http.StatusSeeOther {
+		t.Errorf("revoking: got %d; want 303", code)
+	}
+
+	passkeys, err := app.passkeys.ForUser(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(passkeys) != 1 || passkeys[0].Name != "Work laptop" {
+		t.Fatalf("got passkeys %+v; want only Work laptop", passkeys)
+	}
+
+	// The revoked passkey no longer logs in, while the other one still does
+	if code, _ := loginWithPasskey(t, newTestServer(t, app.routes()), phone); code != http.StatusUnauthorized {
+		t.Errorf("revoked passkey: got %d; want 401", code)
+	}
+	if code, _ := loginWithPasskey(t, newTestServer(t, app.routes()), laptop); code != http.StatusOK {
+		t.Errorf("remaining passkey: got %d; want 200", code)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// purger removes expired snippets and sessions from a storage backend.
+type purger struct {
+	store    *storage
+	grace    time.Duration // how long snippets are kept after they expire
+	archive  bool          // move snippets to snippets_archive instead of only deleting them
+	infoLog  *log.Logger
+	errorLog *log.Logger
+}
+
+// purge removes expired snippets and sessions once, and logs how many rows
+// were removed.
+func (p *purger) purge() error {
+	n, err := p.store.snippets.PurgeExpired(time.Now().Add(-p.grace), p.archive)
+	if err != nil {
+		return err
+	}
+	if p.archive {
+		p.infoLog.Printf("Archived %d expired snippets", n)
+	} else {
+		p.infoLog.Printf("Purged %d expired snippets", n)
+	}
+
+	n, err = p.store.purgeSessions()
+	if err != nil {
+		return err
+	}
+	p.infoLog.Printf("Purged %d expired sessions", n)
+
+	return nil
+}
+
+// run calls purge every interval until ctx is cancelled. Errors are logged
+// rather than returned, so that one failure doesn't stop later runs.
+func (p *purger) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.purge(); err != nil {
+				p.errorLog.Print(err)
+			}
+		}
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/mgxnch/snippetbox/ui"
@@ -24,7 +25,7 @@ func (app *application) routes() http.Handler {
 	// Chi middlewares have to be declared before routes
 	r.Use(app.recoverPanic)
 	r.Use(app.logRequest)
-	r.Use(secureHeaders)
+	r.Use(app.secureHeaders)
 
 	// File server and its route
 	// Convert ui.Files from an embedded filesystem to the http.FS type, so that
@@ -44,11 +45,46 @@ func (app *application) routes() http.Handler {
 
 		// Add the handlers for this group
 		r.Get("/", app.home)
-		r.Get("/snippet/view/{id}", app.snippetView)
+		r.Get("/snippets", app.snippetArchive)
+		r.Get("/tag/{name}", app.tagView)
+		r.Get("/search", app.search)
 		r.Get("/user/signup", app.userSignup)
 		r.Post("/user/signup", app.userSignupPost)
 		r.Get("/user/login", app.userLogin)
 		r.Post("/user/login", app.userLoginPost)
+		r.Get("/user/login/2fa", app.twoFactorLogin)
+		r.Post("/user/login/2fa", app.twoFactorLoginPost)
+		r.Post("/user/passkeys/login/begin", app.passkeyLoginBegin)
+		r.Post("/user/passkeys/login/finish", app.passkeyLoginFinish)
+		r.Get("/user/password/forgot", app.passwordForgot)
+		r.Post("/user/password/forgot", app.passwordForgotPost)
+		r.Get("/user/password/reset/{token}", app.passwordReset)
+		r.Post("/user/password/reset/{token}", app.passwordResetPost)
+		r.Get("/user/verify/{token}", app.verifyEmail)
+
+		// Routes with a snippet's public ID or slug in {id}. Legacy URLs with
+		// its integer ID are redirected.
+		r.Group(func(r chi.Router) {
+			r.Use(app.redirectLegacyID)
+
+			r.Get("/snippet/view/{id}", app.snippetView)
+			r.Post("/snippet/unlock/{id}", app.snippetUnlockPost)
+			r.Post("/snippet/reveal/{id}", app.snippetRevealPost)
+			r.Get("/snippet/raw/{id}", app.snippetRaw)
+			r.Get("/snippet/download/{id}", app.snippetDownload)
+			r.Get("/snippet/view/{id}/history", app.snippetHistory)
+			r.Get("/snippet/view/{id}/diff", app.snippetDiff)
+		})
+
+		// Routes for logged-in users who may not have verified their email
+		// address yet
+		r.Group(func(r chi.Router) {
+			r.Use(app.requireLogin)
+
+			r.Post("/user/logout", app.userLogoutPost)
+			r.Get("/user/account", app.userAccount)
+			r.Post("/user/verify/resend", app.verifyResendPost)
+		})
 
 		// Authenticated routes
 		r.Group(func(r chi.Router) {
@@ -56,7 +92,61 @@ func (app *application) routes() http.Handler {
 
 			r.Get("/snippet/create", app.snippetCreate)
 			r.Post("/snippet/create", app.snippetCreatePost)
-			r.Post("/user/logout", app.userLogoutPost)
+			r.Get("/snippet/mine", app.snippetMine)
+			r.Post("/user/tokens/create", app.tokenCreatePost)
+			r.Post("/user/tokens/revoke/{id}", app.tokenRevokePost)
+			r.Get("/user/2fa/enable", app.totpEnable)
+			r.Post("/user/2fa/enable", app.totpEnablePost)
+			r.Get("/user/2fa/qr.png", app.totpQRCode)
+			r.Get("/user/2fa/disable", app.totpDisable)
+			r.Post("/user/2fa/disable", app.totpDisablePost)
+			r.Post("/user/passkeys/add/begin", app.passkeyAddBegin)
+			r.Post("/user/passkeys/add/finish", app.passkeyAddFinish)
+			r.Get("/user/passkeys/rename/{id}", app.passkeyRename)
+			r.Post("/user/passkeys/rename/{id}", app.passkeyRenamePost)
+			r.Post("/user/passkeys/revoke/{id}", app.passkeyRevokePost)
+
+			r.Group(func(r chi.Router) {
+				r.Use(app.redirectLegacyID)
+
+				r.Get("/snippet/edit/{id}", app.snippetEdit)
+				r.Post("/snippet/edit/{id}", app.snippetEditPost)
+				r.Post("/snippet/delete/{id}", app.snippetDeletePost)
+				r.Post("/snippet/restore/{id}/{version}", app.snippetRestorePost)
+			})
+		})
+	})
+
+	// JSON API routes. These mirror the HTML routes above, but every response,
+	// including errors, is JSON.
+	r.Route("/api/v1", func(r chi.Router) {
+		// authenticateToken runs first so that token-authenticated requests
+		// can skip the CSRF checks in apiNoSurf
+		r.Use(app.sessionManager.LoadAndSave, app.authenticateToken, app.apiNoSurf, app.authenticate)
+
+		r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+			app.apiNotFound(w)
+		})
+		r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+			app.apiClientError(w, http.StatusMethodNotAllowed, fmt.Sprintf("the %s method is not supported for this resource", r.Method))
+		})
+
+		r.Get("/snippets", app.apiSnippetList)
+		r.With(app.redirectLegacyID).Get("/snippets/{id}", app.apiSnippetGet)
+		r.Get("/search", app.apiSearch)
+
+		// Authenticated routes
+		r.Group(func(r chi.Router) {
+			r.Use(app.apiRequireAuthentication, app.requireWriteScope)
+
+			r.Post("/snippets", app.apiSnippetCreate)
+
+			r.Group(func(r chi.Router) {
+				r.Use(app.redirectLegacyID)
+
+				r.Put("/snippets/{id}", app.apiSnippetUpdate)
+				r.Delete("/snippets/{id}", app.apiSnippetDelete)
+			})
 		})
 	})
 
@@ -78,6 +168,10 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 			if err := recover(); err != nil {
 				// Close the connection and return a server error
 				w.Header().Set("Connection", "close")
+				if strings.HasPrefix(r.URL.Path, "/api/") {
+					app.apiServerError(w, fmt.Errorf("%s", err))
+					return
+				}
 				app.serverError(w, fmt.Errorf("%s", err))
 			}
 		}()
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// serve starts srv and blocks until it has stopped. When the process receives
+// SIGINT or SIGTERM, the server stops accepting connections and waits up to
+// shutdownTimeout for in-flight requests to complete. serve returns nil after
+// a graceful shutdown, and an error if the server failed or the shutdown timed
+// out.
+func (app *application) serve(srv *http.Server, certFile, keyFile string, shutdownTimeout time.Duration) error {
+	shutdownErr := make(chan error)
+
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		s := <-quit
+
+		// A second signal kills the process straight away
+		signal.Stop(quit)
+
+		app.infoLog.Printf("Caught %s signal, shutting down server", s)
+
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		shutdownErr <- srv.Shutdown(ctx)
+	}()
+
+	app.infoLog.Printf("Starting server on http://localhost%s", srv.Addr)
+
+	// ListenAndServeTLS returns http.ErrServerClosed as soon as Shutdown is
+	// called, so we wait for Shutdown itself to return below
+	err := srv.ListenAndServeTLS(certFile, keyFile)
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	err = <-shutdownErr
+	if err != nil {
+		return fmt.Errorf("shutting down server: %w", err)
+	}
+
+	app.infoLog.Print("Server stopped accepting requests")
+	return nil
+}
+
+// runInBackground runs fn in a goroutine that main waits for before the process
+// exits. fn must return soon after ctx is cancelled.
+func (app *application) runInBackground(ctx context.Context, fn func(context.Context)) {
+	app.background.Add(1)
+
+	go func() {
+		defer app.background.Done()
+		fn(ctx)
+	}()
+}
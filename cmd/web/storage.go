@@ -0,0 +1,142 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/alexedwards/scs/mysqlstore"
+	"github.com/alexedwards/scs/sqlite3store"
+	"github.com/alexedwards/scs/v2"
+	"github.com/alexedwards/scs/v2/memstore"
+	"github.com/mgxnch/snippetbox/internal/migrate"
+	"github.com/mgxnch/snippetbox/internal/models"
+	"github.com/mgxnch/snippetbox/internal/models/memory"
+	"github.com/mgxnch/snippetbox/internal/models/sqlite"
+	"github.com/mgxnch/snippetbox/migrations"
+)
+
+// defaultDSNs holds the data source name used by each driver when -dsn is not
+// set. The MySQL password belongs in the config file or SNIPPETBOX_DSN.
+var defaultDSNs = map[string]string{
+	"mysql":  "web@/snippetbox?parseTime=true",
+	"sqlite": "snippetbox.db",
+	"memory": "",
+}
+
+// storage holds the stores of one storage backend.
+type storage struct {
+	snippets  models.SnippetStore
+	users     models.UserStore
+	tokens    models.TokenStore
+	resets    models.PasswordResetStore
+	twoFactor models.TwoFactorStore
+	passkeys  models.PasskeyStore
+	sessions  scs.Store
+	db        *sql.DB // nil for the in-memory backend
+	driver    string  // also names the directory of the backend's migrations
+}
+
+// migrator returns a migrate.Migrator for the backend's database. It returns
+// an error for the in-memory backend, which has no schema.
+func (s *storage) migrator() (*migrate.Migrator, error) {
+	if s.db == nil {
+		return nil, fmt.Errorf("the %s driver does not use migrations", s.driver)
+	}
+
+	migrations, err := migrate.Load(migrations.Files, s.driver)
+	if err != nil {
+		return nil, err
+	}
+
+	return &migrate.Migrator{DB: s.db, Migrations: migrations}, nil
+}
+
+// purgeSessions deletes expired sessions and returns how many were deleted. The
+// scs stores also do this on their own every few minutes, but only while the
+// server is running. The in-memory store is never purged by hand.
+func (s *storage) purgeSessions() (int, error) {
+	var stmt string
+	switch s.driver {
+	case "mysql":
+		stmt = "DELETE FROM sessions WHERE expiry < UTC_TIMESTAMP(6)"
+	case "sqlite":
+		stmt = "DELETE FROM sessions WHERE expiry < julianday('now')"
+	default:
+		return 0, nil
+	}
+
+	result, err := s.db.Exec(stmt)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// Close stops the session store's cleanup goroutine, and then closes the
+// database. It must only be called once.
+func (s *storage) Close() error {
+	// All of the scs stores that we use delete expired sessions in a goroutine
+	if c, ok := s.sessions.(interface{ StopCleanup() }); ok {
+		c.StopCleanup()
+	}
+
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// openStorage sets up the storage backend for driver, which is one of "mysql",
+// "sqlite" or "memory". New passwords are hashed with the given bcrypt cost.
+func openStorage(driver, dsn string, bcryptCost int) (*storage, error) {
+	switch driver {
+	case "mysql":
+		db, err := openDB(dsn)
+		if err != nil {
+			return nil, err
+		}
+		return &storage{
+			snippets:  &models.SnippetModel{DB: db},
+			users:     &models.UserModel{DB: db, BcryptCost: bcryptCost},
+			tokens:    &models.TokenModel{DB: db},
+			resets:    &models.PasswordResetModel{DB: db},
+			twoFactor: &models.TwoFactorModel{DB: db},
+			passkeys:  &models.PasskeyModel{DB: db},
+			sessions:  mysqlstore.New(db),
+			db:        db,
+			driver:    driver,
+		}, nil
+	case "sqlite":
+		db, err := sqlite.Open(dsn)
+		if err != nil {
+			return nil, err
+		}
+		return &storage{
+			snippets:  &sqlite.SnippetModel{DB: db},
+			users:     &sqlite.UserModel{DB: db, BcryptCost: bcryptCost},
+			tokens:    &sqlite.TokenModel{DB: db},
+			resets:    &sqlite.PasswordResetModel{DB: db},
+			twoFactor: &sqlite.TwoFactorModel{DB: db},
+			passkeys:  &sqlite.PasskeyModel{DB: db},
+			sessions:  sqlite3store.New(db),
+			db:        db,
+			driver:    driver,
+		}, nil
+	case "memory":
+		db := memory.New()
+		return &storage{
+			snippets:  &memory.SnippetModel{DB: db},
+			users:     &memory.UserModel{DB: db, BcryptCost: bcryptCost},
+			tokens:    &memory.TokenModel{DB: db},
+			resets:    &memory.PasswordResetModel{DB: db},
+			twoFactor: &memory.TwoFactorModel{DB: db},
+			passkeys:  &memory.PasskeyModel{DB: db},
+			sessions:  memstore.New(),
+			driver:    driver,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", driver)
+	}
+}
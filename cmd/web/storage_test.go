@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mgxnch/snippetbox/internal/models"
+)
+
+// insertTestSnippet adds a user and a snippet of theirs with in to store, and
+// returns the snippet.
+func insertTestSnippet(t *testing.T, store *storage, in models.SnippetInput) *models.Snippet {
+	t.Helper()
+
+	if err := store.users.Insert("Alice", "alice@example.com", "pa$$word"); err != nil {
+		t.Fatal(err)
+	}
+	user, err := store.users.GetByEmail("alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in.Title = "Title"
+	in.Content = "Content"
+	in.Format = models.FormatPlain
+	in.Visibility = models.VisibilityPublic
+	in.Expires = 1
+
+	id, err := store.snippets.Insert(user.ID, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snippet, err := store.snippets.Get(id, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return snippet
+}
+
+func TestSnippetStoreBurn(t *testing.T) {
+	for _, driver := range testDrivers() {
+		t.Run(driver, func(t *testing.T) {
+			store := newTestStorage(t, driver)
+			snippet := insertTestSnippet(t, store, models.SnippetInput{BurnAfterReading: true})
+
+			// Of many concurrent viewers, exactly one gets the snippet back
+			var mu sync.Mutex
+			var burned, gone int
+			var wg sync.WaitGroup
+			for range 20 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					s, err := store.snippets.Burn(snippet.ID)
+
+					mu.Lock()
+					defer mu.Unlock()
+					switch {
+					case err == nil:
+						burned++
+						if s.Content != "Content" {
+							t.Errorf("got content %q", s.Content)
+						}
+					case errors.Is(err, models.ErrNoRecord):
+						gone++
+					default:
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if burned != 1 || gone != 19 {
+				t.Errorf("got %d burned and %d gone, want 1 and 19", burned, gone)
+			}
+
+			s, err := store.snippets.Get(snippet.ID, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !s.Burned || s.Content != "" {
+				t.Errorf("after burning: got burned %t with content %q", s.Burned, s.Content)
+			}
+		})
+	}
+}
+
+func TestSnippetStorePurgeArchive(t *testing.T) {
+	for _, driver := range testDrivers() {
+		if driver == "memory" {
+			continue
+		}
+		t.Run(driver, func(t *testing.T) {
+			store := newTestStorage(t, driver)
+			snippet := insertTestSnippet(t, store, models.SnippetInput{Language: "go", Tags: []string{"sql", "go"}})
+
+			n, err := store.snippets.PurgeExpired(time.Now().Add(48*time.Hour), true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 1 {
+				t.Fatalf("purged %d snippets, want 1", n)
+			}
+
+			// The archive keeps what the snippet needs to be restored
+			var publicID, format, language, visibility, tags string
+			stmt := `SELECT public_id, format, language, visibility, tags FROM snippets_archive WHERE id = ?`
+			err = store.db.QueryRow(stmt, snippet.ID).Scan(&publicID, &format, &language, &visibility, &tags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{publicID, format, language, visibility, tags}
+			want := []string{snippet.PublicID, models.FormatPlain, "go", models.VisibilityPublic, "go,sql"}
+			if !slices.Equal(got, want) {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
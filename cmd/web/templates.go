@@ -4,9 +4,15 @@ import (
 	"html/template"
 	"io/fs"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
+	"unicode"
 
+	"github.com/mgxnch/snippetbox/internal/diff"
+	"github.com/mgxnch/snippetbox/internal/markdown"
 	"github.com/mgxnch/snippetbox/internal/models"
+	"github.com/mgxnch/snippetbox/internal/syntax"
 	"github.com/mgxnch/snippetbox/ui"
 )
 
@@ -14,20 +20,85 @@ import (
 // ExecuteTemplate(), allowing us to pass multiple data fields into
 // ExecuteTemplate, which only accepts a single data object in its parameters.
 type templateData struct {
-	CurrentYear     int
-	Snippet         *models.Snippet
-	Snippets        []*models.Snippet
-	Form            any    // holds validation errors
-	Flash           string // holds the flash message
-	IsAuthenticated bool   // true if user is authenticated, false otherwise
-	CSRFToken       string // holds the CSRF token
+	CurrentYear         int
+	Snippet             *models.Snippet
+	Snippets            []*models.Snippet
+	List                *models.SnippetList // a page of a paginated listing
+	PageSizes           []int               // choices of the size of List's pages
+	Revisions           []*models.Revision
+	Diff                *revisionDiff // holds the comparison of two revisions
+	Search              *models.SearchResults
+	TagCloud            []tagCloudEntry
+	Languages           []syntax.Language // choices of the language selectors
+	User                *models.User
+	TwoFactor           *models.TwoFactor // nil unless the user has turned on two-factor authentication
+	RecoveryCodes       []string          // plaintext of newly generated recovery codes
+	TOTPSecret          string            // TOTP secret that the user is adding to their authenticator app
+	TOTPURI             template.URL      // otpauth:// URI of TOTPSecret, which html/template would otherwise refuse in links
+	Passkeys            []*models.Passkey
+	Passkey             *models.Passkey // passkey being renamed
+	Tokens              []*models.Token
+	NewToken            string // plaintext of a newly created API token
+	Form                any    // holds validation errors
+	Flash               string // holds the flash message
+	IsAuthenticated     bool   // true if user is authenticated, false otherwise
+	AuthenticatedUserID int    // ID of the logged-in user, 0 otherwise
+	CSRFToken           string // holds the CSRF token
+}
+
+// revisionDiff holds two revisions of a snippet and the differences between them.
+type revisionDiff struct {
+	From     *models.Revision
+	To       *models.Revision
+	Hunks    []diff.Hunk
+	TooLarge bool // the revisions have too many changed lines to be compared
+}
+
+// tagCloudSize is the number of tags in the tag cloud on the home page.
+const tagCloudSize = 30
+
+// tagCloudEntry is a tag in the tag cloud. Weight runs from 1 for the least
+// used tags to 5 for the most used, and sets the tag's font size.
+type tagCloudEntry struct {
+	Name   string
+	Count  int
+	Weight int
+}
+
+// newTagCloud returns the tag cloud of counts, in alphabetical order.
+func newTagCloud(counts []*models.TagCount) []tagCloudEntry {
+	if len(counts) == 0 {
+		return nil
+	}
+
+	// counts is sorted with the most used tag first
+	most, least := counts[0].Count, counts[len(counts)-1].Count
+
+	cloud := make([]tagCloudEntry, 0, len(counts))
+	for _, c := range counts {
+		weight := 1
+		if most > least {
+			weight += 4 * (c.Count - least) / (most - least)
+		}
+		cloud = append(cloud, tagCloudEntry{Name: c.Name, Count: c.Count, Weight: weight})
+	}
+
+	slices.SortFunc(cloud, func(a, b tagCloudEntry) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return cloud
 }
 
 // functions acts as a lookup between the names of our custom template
 // functions and the functions. Custom template functions must only
 // return one value, or two values where the second value is an error.
 var functions = template.FuncMap{
-	"humanDate": humanDate,
+	"humanDate":     humanDate,
+	"excerpt":       excerpt,
+	"highlight":     highlight,
+	"highlightCode": syntax.Highlight,
+	"markdown":      markdown.Render,
+	"formatTitle":   formatTitle,
 }
 
 func newTemplateCache() (map[string]*template.Template, error) {
@@ -74,3 +145,95 @@ func humanDate(t time.Time) string {
 	// ref: https://stackoverflow.com/questions/28087471/what-is-the-significance-of-gos-time-formatlayout-string-reference-time
 	return t.Format("02 Jan 2006 15:04")
 }
+
+// formatTitle is used as a template function which describes how the content
+// of snippet s is displayed: as the language it is highlighted as, or as
+// markdown or plain text.
+func formatTitle(s *models.Snippet) string {
+	switch s.Format {
+	case models.FormatMarkdown:
+		return "Markdown"
+	case models.FormatPlain:
+		return "Plain text"
+	default:
+		return syntax.Title(s.Language)
+	}
+}
+
+// excerptLength is the number of characters of a snippet's content that
+// excerpt keeps.
+const excerptLength = 200
+
+// excerpt is used as a template function which shortens text to around
+// excerptLength characters, keeping the first word that is one of terms.
+func excerpt(text string, terms []string) string {
+	runes := []rune(text)
+	if len(runes) <= excerptLength {
+		return text
+	}
+
+	// Start a little before the first match, so that it is shown in context
+	start := 0
+	for _, w := range wordSpans(runes) {
+		if slices.Contains(terms, strings.ToLower(string(runes[w[0]:w[1]]))) {
+			start = min(max(w[0]-excerptLength/4, 0), len(runes)-excerptLength)
+			break
+		}
+	}
+	end := start + excerptLength
+
+	excerpt := string(runes[start:end])
+	if start > 0 {
+		excerpt = "…" + excerpt
+	}
+	if end < len(runes) {
+		excerpt += "…"
+	}
+	return excerpt
+}
+
+// highlight is used as a template function which escapes text and wraps the
+// words that are one of terms in <mark> elements. terms must be lowercase, as
+// returned by models.SearchTerms.
+func highlight(text string, terms []string) template.HTML {
+	runes := []rune(text)
+
+	var b strings.Builder
+	last := 0
+	for _, w := range wordSpans(runes) {
+		word := string(runes[w[0]:w[1]])
+		if !slices.Contains(terms, strings.ToLower(word)) {
+			continue
+		}
+
+		b.WriteString(template.HTMLEscapeString(string(runes[last:w[0]])))
+		b.WriteString("<mark>")
+		b.WriteString(template.HTMLEscapeString(word))
+		b.WriteString("</mark>")
+		last = w[1]
+	}
+	b.WriteString(template.HTMLEscapeString(string(runes[last:])))
+
+	return template.HTML(b.String())
+}
+
+// wordSpans returns the start and end indexes of the words in runes, split the
+// same way as models.Words.
+func wordSpans(runes []rune) [][2]int {
+	var spans [][2]int
+	start := -1
+	for i, r := range runes {
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case inWord && start < 0:
+			start = i
+		case !inWord && start >= 0:
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(runes)})
+	}
+	return spans
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/go-playground/form/v4"
+	"github.com/mgxnch/snippetbox/internal/mailer"
+	"github.com/mgxnch/snippetbox/internal/ratelimit"
+	"github.com/mgxnch/snippetbox/internal/signer"
+)
+
+// newTestApplication returns an application with the in-memory storage
+// backend, whose links and passkeys belong to https://snippetbox.test, and
+// whose emails are kept by a testMailer.
+func newTestApplication(t *testing.T) *application {
+	return newTestApplicationFor(t, newTestStorage(t, "memory"))
+}
+
+// testDrivers returns the storage backends that tests which depend on the
+// backend run against. MySQL is only among them if SNIPPETBOX_TEST_MYSQL_DSN
+// holds the DSN of an empty database, which its migrations are applied to.
+func testDrivers() []string {
+	drivers := []string{"memory", "sqlite"}
+	if os.Getenv("SNIPPETBOX_TEST_MYSQL_DSN") != "" {
+		drivers = append(drivers, "mysql")
+	}
+	return drivers
+}
+
+// newTestStorage opens the storage backend for driver, with an up to date
+// schema, in a new temporary SQLite database for the sqlite driver. Its
+// session store isn't stopped, as that races with its cleanup goroutine.
+func newTestStorage(t *testing.T, driver string) *storage {
+	t.Helper()
+
+	var dsn string
+	switch driver {
+	case "sqlite":
+		dsn = filepath.Join(t.TempDir(), "snippetbox.db")
+	case "mysql":
+		dsn = os.Getenv("SNIPPETBOX_TEST_MYSQL_DSN")
+	}
+
+	store, err := openStorage(driver, dsn, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.db == nil {
+		return store
+	}
+	t.Cleanup(func() { store.db.Close() })
+
+	migrator, err := store.migrator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	return store
+}
+
+// newTestApplicationFor is newTestApplication with the storage backend store.
+func newTestApplicationFor(t *testing.T, store *storage) *application {
+	t.Helper()
+
+	templateCache, err := newTemplateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config{baseURL: "https://snippetbox.test", csp: defaultCSP, bcryptCost: 4}
+
+	webAuthn, err := newWebAuthn(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessionManager := scs.New()
+	sessionManager.Store = store.sessions
+	sessionManager.Lifetime = time.Hour
+	sessionManager.Cookie.Secure = true
+
+	return &application{
+		config:         cfg,
+		infoLog:        log.New(io.Discard, "", 0),
+		errorLog:       log.New(io.Discard, "", 0),
+		snippets:       store.snippets,
+		users:          store.users,
+		tokens:         store.tokens,
+		resets:         store.resets,
+		twoFactor:      store.twoFactor,
+		passkeys:       store.passkeys,
+		templateCache:  templateCache,
+		formDecoder:    form.NewDecoder(),
+		sessionManager: sessionManager,
+		snippetGuesses: ratelimit.New(20, time.Hour),
+		clientGuesses:  ratelimit.New(10, 15*time.Minute),
+		resetEmails:    ratelimit.New(3, time.Hour),
+		verifyEmails:   ratelimit.New(3, time.Hour),
+		codeGuesses:    ratelimit.New(5, 15*time.Minute),
+		accountLogins:  ratelimit.NewBackoff(time.Second, 10, accountLockout),
+		clientLogins:   ratelimit.NewBackoff(100*time.Millisecond, 50, time.Hour),
+		mailer:         &testMailer{},
+		signer:         signer.New([]byte("0123456789abcdef0123456789abcdef")),
+		webAuthn:       webAuthn,
+	}
+}
+
+// testMailer keeps the emails that it is asked to send.
+type testMailer struct {
+	mu   sync.Mutex
+	sent []mailer.Message
+}
+
+func (m *testMailer) Send(msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// messages returns the emails sent so far, once those being sent in the
+// background of app have been.
+func (m *testMailer) messages(app *application) []mailer.Message {
+	app.background.Wait()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]mailer.Message(nil), m.sent...)
+}
+
+// testServer is an HTTPS server of the application with a client that keeps
+// cookies, like a browser, but doesn't follow redirects.
+type testServer struct {
+	*httptest.Server
+}
+
+func newTestServer(t *testing.T, h http.Handler) *testServer {
+	ts := httptest.NewTLSServer(h)
+	t.Cleanup(ts.Close)
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Client().Jar = jar
+
+	ts.Client().CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return &testServer{ts}
+}
+
+// do sends a request with body to the server, and returns the status code,
+// headers and body of the response. POST requests carry the CSRF token and
+// Referer that nosurf checks.
+func (ts *testServer) do(t *testing.T, method, urlPath, contentType string, body []byte) (int, http.Header, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, ts.URL+urlPath, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("X-CSRF-Token", ts.csrfToken(t))
+		req.Header.Set("Referer", ts.URL+"/")
+	}
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	b, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rs.StatusCode, rs.Header, string(bytes.TrimSpace(b))
+}
+
+func (ts *testServer) get(t *testing.T, urlPath string) (int, http.Header, string) {
+	t.Helper()
+	return ts.do(t, http.MethodGet, urlPath, "", nil)
+}
+
+func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (int, http.Header, string) {
+	t.Helper()
+	return ts.do(t, http.MethodPost, urlPath, "application/x-www-form-urlencoded", []byte(form.Encode()))
+}
+
+func (ts *testServer) postJSON(t *testing.T, urlPath string, body []byte) (int, http.Header, string) {
+	t.Helper()
+	return ts.do(t, http.MethodPost, urlPath, "application/json", body)
+}
+
+var csrfTokenRX = regexp.MustCompile(`<input type="hidden" name="csrf_token" value="(.+)">`)
+
+// csrfToken returns the CSRF token of the client's session, from the login
+// page.
+func (ts *testServer) csrfToken(t *testing.T) string {
+	t.Helper()
+
+	rs, err := ts.Client().Get(ts.URL + "/user/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	b, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matches := csrfTokenRX.FindStringSubmatch(string(b))
+	if len(matches) < 2 {
+		t.Fatal("no csrf token found in body")
+	}
+
+	return html.UnescapeString(strings.TrimSpace(matches[1]))
+}
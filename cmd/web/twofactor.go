@@ -0,0 +1,407 @@
+package main
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mgxnch/snippetbox/internal/models"
+	"github.com/mgxnch/snippetbox/internal/totp"
+	"github.com/mgxnch/snippetbox/internal/validator"
+	"github.com/skip2/go-qrcode"
+)
+
+// Session keys of two-factor authentication.
+const (
+	twoFactorUserKey    = "twoFactorUserID"  // user who has entered their password, but not yet their code
+	twoFactorExpiresKey = "twoFactorExpires" // Unix time until which twoFactorUserKey can log in
+	totpSecretKey       = "totpSecret"       // secret being added to an authenticator app, until it is confirmed
+	recoveryCodesKey    = "recoveryCodes"    // newly generated recovery codes, separated by spaces
+)
+
+// twoFactorLoginTTL is how long users have to enter their code after their
+// password.
+const twoFactorLoginTTL = 5 * time.Minute
+
+// recoveryCodeCount is how many recovery codes users get when they turn on
+// two-factor authentication.
+const recoveryCodeCount = 10
+
+// totpIssuer names the application in authenticator apps.
+const totpIssuer = "Snippetbox"
+
+// twoFactorCodeForm holds a code from an authenticator app, or a recovery
+// code.
+type twoFactorCodeForm struct {
+	Code                string `form:"code"`
+	validator.Validator `form:"-"`
+}
+
+// twoFactorDisableForm holds the password that users enter again to turn off
+// two-factor authentication.
+type twoFactorDisableForm struct {
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+// startTwoFactorLogin is called instead of logging in the user with id, who
+// has entered the right password but has two-factor authentication turned on.
+// It remembers the user in the session for a short while, until they enter a
+// code.
+func (app *application) startTwoFactorLogin(w http.ResponseWriter, r *http.Request, id int) {
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Remove(r.Context(), authUserKey)
+	app.sessionManager.Put(r.Context(), twoFactorUserKey, id)
+	app.sessionManager.Put(r.Context(), twoFactorExpiresKey, time.Now().Add(twoFactorLoginTTL).Unix())
+
+	http.Redirect(w, r, "/user/login/2fa", http.StatusSeeOther)
+}
+
+// twoFactorLoginUser returns the ID of the user who has entered their password
+// and has yet to enter a code, or 0 if there is none, or they took too long.
+func (app *application) twoFactorLoginUser(r *http.Request) int {
+	if time.Now().Unix() >= app.sessionManager.GetInt64(r.Context(), twoFactorExpiresKey) {
+		return 0
+	}
+	return app.sessionManager.GetInt(r.Context(), twoFactorUserKey)
+}
+
+func (app *application) twoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	if app.twoFactorLoginUser(r) == 0 {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = twoFactorCodeForm{}
+	app.render(w, http.StatusOK, "twofactor.tmpl", data)
+}
+
+func (app *application) twoFactorLoginPost(w http.ResponseWriter, r *http.Request) {
+	id := app.twoFactorLoginUser(r)
+	if id == 0 {
+		app.sessionManager.Put(r.Context(), "flash", "You took too long to enter your code. Please log in again.")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	var form twoFactorCodeForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Code), "code", "This field cannot be blank")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "twofactor.tmpl", data)
+		return
+	}
+
+	// Codes only have 6 digits, so the number of wrong ones must be limited,
+	// or they could simply be tried one after another. Every code counts as a
+	// guess until it turns out to be right, so that concurrent requests can't
+	// all be let in before any of them is found to be wrong.
+	key := strconv.Itoa(id)
+	if ok, wait := app.codeGuesses.Try(key); !ok {
+		setRetryAfter(w, wait)
+		form.AddNonFieldError("Too many incorrect codes. Please try again later.")
+
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusTooManyRequests, "twofactor.tmpl", data)
+		return
+	}
+
+	recovery, err := app.checkTwoFactorCode(id, form.Code)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			form.AddFieldError("code", "Code is incorrect")
+
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, http.StatusUnprocessableEntity, "twofactor.tmpl", data)
+			return
+		}
+		app.codeGuesses.Cancel(key)
+		app.serverError(w, err)
+		return
+	}
+	app.codeGuesses.Cancel(key)
+
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Remove(r.Context(), twoFactorUserKey)
+	app.sessionManager.Remove(r.Context(), twoFactorExpiresKey)
+	app.sessionManager.Put(r.Context(), authUserKey, id)
+
+	if recovery {
+		app.sessionManager.Put(r.Context(), "flash", "You've used one of your recovery codes, which can't be used again. You can see how many you have left on your account page.")
+	}
+
+	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+}
+
+// checkTwoFactorCode checks a code entered by the user with id, which is
+// either from their authenticator app, or one of their recovery codes, and
+// uses it up. It returns models.ErrInvalidCredentials if the code is wrong or
+// has already been used, and whether it was a recovery code otherwise.
+func (app *application) checkTwoFactorCode(id int, code string) (recovery bool, err error) {
+	tf, err := app.twoFactor.Get(id)
+	if err != nil {
+		// Two-factor authentication was turned off in the meantime
+		if errors.Is(err, models.ErrNoRecord) {
+			return false, models.ErrInvalidCredentials
+		}
+		return false, err
+	}
+
+	if step, ok := totp.Validate(tf.Secret, strings.ReplaceAll(code, " ", ""), time.Now()); ok {
+		return false, app.twoFactor.UseStep(id, step)
+	}
+	return true, app.twoFactor.UseRecoveryCode(id, code)
+}
+
+// totpEnable displays the secret of a new authenticator app entry, as a
+// QR code and as text, and a form to confirm it with a code. The secret is
+// kept in the session until then, so that reloading the page doesn't change
+// it.
+func (app *application) totpEnable(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.twoFactorUser(w, r, false)
+	if !ok {
+		return
+	}
+
+	secret := app.sessionManager.GetString(r.Context(), totpSecretKey)
+	if secret == "" {
+		var err error
+		secret, err = totp.GenerateSecret()
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		app.sessionManager.Put(r.Context(), totpSecretKey, secret)
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = twoFactorCodeForm{}
+	app.renderTOTPEnable(w, http.StatusOK, data, user, secret)
+}
+
+// renderTOTPEnable renders the page of totpEnable for the secret.
+func (app *application) renderTOTPEnable(w http.ResponseWriter, status int, data *templateData, user *models.User, secret string) {
+	data.TOTPSecret = secret
+	data.TOTPURI = template.URL(totp.URI(secret, totpIssuer, user.Email))
+	app.render(w, status, "twofactor_enable.tmpl", data)
+}
+
+// totpQRCode writes the otpauth:// URI of the secret from totpEnable
+// as a QR code, which authenticator apps can scan. It is a separate PNG
+// rather than a data: URL, which the Content-Security-Policy would block.
+func (app *application) totpQRCode(w http.ResponseWriter, r *http.Request) {
+	secret := app.sessionManager.GetString(r.Context(), totpSecretKey)
+	if secret == "" {
+		app.notFound(w)
+		return
+	}
+
+	user, err := app.users.Get(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	png, err := qrcode.Encode(totp.URI(secret, totpIssuer, user.Email), qrcode.Medium, 256)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(png)
+}
+
+func (app *application) totpEnablePost(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.twoFactorUser(w, r, false)
+	if !ok {
+		return
+	}
+
+	secret := app.sessionManager.GetString(r.Context(), totpSecretKey)
+	if secret == "" {
+		http.Redirect(w, r, "/user/2fa/enable", http.StatusSeeOther)
+		return
+	}
+
+	var form twoFactorCodeForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// A code shows that the user has added the secret to their app correctly,
+	// so that they don't lock themselves out
+	form.CheckField(validator.NotBlank(form.Code), "code", "This field cannot be blank")
+	step, valid := totp.Validate(secret, strings.ReplaceAll(form.Code, " ", ""), time.Now())
+	if form.Valid() {
+		form.CheckField(valid, "code", "Code is incorrect")
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.renderTOTPEnable(w, http.StatusUnprocessableEntity, data, user, secret)
+		return
+	}
+
+	codes, err := models.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.twoFactor.Enable(user.ID, secret, codes)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// The code that was just entered can't be used to log in
+	err = app.twoFactor.UseStep(user.ID, step)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Remove(r.Context(), totpSecretKey)
+	// The recovery codes are only ever shown once, like new API tokens
+	app.sessionManager.Put(r.Context(), recoveryCodesKey, strings.Join(codes, " "))
+	app.sessionManager.Put(r.Context(), "flash", "Two-factor authentication is now on.")
+
+	http.Redirect(w, r, "/user/account", http.StatusSeeOther)
+}
+
+func (app *application) totpDisable(w http.ResponseWriter, r *http.Request) {
+	if _, ok := app.twoFactorUser(w, r, true); !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = twoFactorDisableForm{}
+	app.render(w, http.StatusOK, "twofactor_disable.tmpl", data)
+}
+
+// totpDisablePost turns off two-factor authentication once the user has
+// entered their password again, so that someone who finds them logged in
+// can't.
+func (app *application) totpDisablePost(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.twoFactorUser(w, r, true)
+	if !ok {
+		return
+	}
+
+	var form twoFactorDisableForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+
+	// Wrong passwords count against the account like those on the login page,
+	// so that someone who finds the user logged in can't guess it here instead
+	status := http.StatusUnprocessableEntity
+	if form.Valid() {
+		key := strings.ToLower(user.Email)
+		if ok, wait := app.accountLogins.Try(key); !ok {
+			setRetryAfter(w, wait)
+			status = http.StatusTooManyRequests
+			form.AddFieldError("password", "Too many attempts. Please try again later.")
+		} else {
+			_, err = app.users.Authenticate(user.Email, form.Password)
+			switch {
+			case err == nil:
+				app.accountLogins.Reset(key)
+			case errors.Is(err, models.ErrInvalidCredentials):
+				if app.accountLogins.Fail(key) {
+					err = app.sendLockoutNotice(user.Email, clientIP(r))
+					if err != nil {
+						app.serverError(w, err)
+						return
+					}
+				}
+				form.AddFieldError("password", "Password is incorrect")
+			default:
+				app.accountLogins.Cancel(key)
+				app.serverError(w, err)
+				return
+			}
+		}
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, status, "twofactor_disable.tmpl", data)
+		return
+	}
+
+	err = app.twoFactor.Disable(user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Two-factor authentication is now off.")
+	http.Redirect(w, r, "/user/account", http.StatusSeeOther)
+}
+
+// twoFactorUser fetches the logged-in user for the pages that turn two-factor
+// authentication on and off, and checks that it is off or on respectively,
+// given by enabled. Otherwise it redirects to the account page and returns
+// false.
+func (app *application) twoFactorUser(w http.ResponseWriter, r *http.Request, enabled bool) (user *models.User, ok bool) {
+	user, err := app.users.Get(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return nil, false
+	}
+
+	_, err = app.twoFactor.Get(user.ID)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return nil, false
+	}
+
+	if (err == nil) != enabled {
+		if enabled {
+			app.sessionManager.Put(r.Context(), "flash", "Two-factor authentication is already off.")
+		} else {
+			app.sessionManager.Put(r.Context(), "flash", "Two-factor authentication is already on.")
+		}
+		http.Redirect(w, r, "/user/account", http.StatusSeeOther)
+		return nil, false
+	}
+
+	return user, true
+}
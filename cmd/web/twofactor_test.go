@@ -0,0 +1,162 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mgxnch/snippetbox/internal/ratelimit"
+	"github.com/mgxnch/snippetbox/internal/totp"
+)
+
+// newTwoFactorUser adds a user who has turned on two-factor authentication
+// with secret, and returns a server on which they have entered their
+// password, so that they are asked for a code.
+func newTwoFactorUser(t *testing.T, app *application, name, email, secret string) *testServer {
+	t.Helper()
+
+	if err := app.users.Insert(name, email, "pa$$word"); err != nil {
+		t.Fatal(err)
+	}
+	user, err := app.users.GetByEmail(email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = app.twoFactor.Enable(user.ID, secret, []string{"k7mqa-x2pdz"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := newTestServer(t, app.routes())
+	enterPassword(t, ts, email)
+
+	return ts
+}
+
+func enterPassword(t *testing.T, ts *testServer, email string) {
+	t.Helper()
+
+	code, header, _ := ts.postForm(t, "/user/login", url.Values{"email": {email}, "password": {"pa$$word"}})
+	if code != http.StatusSeeOther || header.Get("Location") != "/user/login/2fa" {
+		t.Fatalf("entering the password: got %d to %q", code, header.Get("Location"))
+	}
+}
+
+func TestTwoFactorLoginGuesses(t *testing.T) {
+	app := newTestApplication(t)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := newTwoFactorUser(t, app, "Alice", "alice@example.com", secret)
+
+	// Wrong codes are sent at once, and no more of them than the limit may be
+	// checked
+	var mu sync.Mutex
+	codes := make(map[int]int)
+	var wg sync.WaitGroup
+	for range 30 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			code, _, _ := ts.postForm(t, "/user/login/2fa", url.Values{"code": {"not-a-code"}})
+
+			mu.Lock()
+			codes[code]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if codes[http.StatusUnprocessableEntity] != 5 || codes[http.StatusTooManyRequests] != 25 {
+		t.Errorf("got status codes %v, want 5 codes checked and 25 refused", codes)
+	}
+
+	// Even the right code is refused once the guesses have run out
+	right, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _, _ := ts.postForm(t, "/user/login/2fa", url.Values{"code": {right}})
+	if code != http.StatusTooManyRequests {
+		t.Errorf("right code after too many guesses: got %d", code)
+	}
+}
+
+func TestTwoFactorLoginReusedCode(t *testing.T) {
+	app := newTestApplication(t)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := newTwoFactorUser(t, app, "Alice", "alice@example.com", secret)
+
+	right, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, header, _ := ts.postForm(t, "/user/login/2fa", url.Values{"code": {right}})
+	if code != http.StatusSeeOther || header.Get("Location") != "/snippet/create" {
+		t.Fatalf("right code: got %d to %q", code, header.Get("Location"))
+	}
+
+	if code, _, _ := ts.postForm(t, "/user/logout", nil); code != http.StatusSeeOther {
+		t.Fatalf("logging out: got %d", code)
+	}
+	enterPassword(t, ts, "alice@example.com")
+
+	// The code of a time step works only once, so that an intercepted code
+	// can't be replayed
+	code, _, _ = ts.postForm(t, "/user/login/2fa", url.Values{"code": {right}})
+	if code != http.StatusUnprocessableEntity {
+		t.Errorf("reused code: got %d", code)
+	}
+
+	// Recovery codes still work, however they are typed
+	code, _, _ = ts.postForm(t, "/user/login/2fa", url.Values{"code": {"K7MQA X2PDZ"}})
+	if code != http.StatusSeeOther {
+		t.Fatalf("recovery code: got %d", code)
+	}
+}
+
+func TestTwoFactorDisableGuesses(t *testing.T) {
+	app := newTestApplication(t)
+	app.accountLogins = ratelimit.NewBackoff(0, 3, time.Hour)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := newTwoFactorUser(t, app, "Alice", "alice@example.com", secret)
+	if err = app.users.VerifyEmail(1); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, _ := ts.postForm(t, "/user/login/2fa", url.Values{"code": {"k7mqa-x2pdz"}}); code != http.StatusSeeOther {
+		t.Fatalf("recovery code: got %d", code)
+	}
+
+	// Wrong passwords count against the account like those on the login page
+	for i := range 3 {
+		code, _, _ := ts.postForm(t, "/user/2fa/disable", url.Values{"password": {"wrong"}})
+		if code != http.StatusUnprocessableEntity {
+			t.Fatalf("wrong password %d: got %d", i+1, code)
+		}
+	}
+
+	code, header, _ := ts.postForm(t, "/user/2fa/disable", url.Values{"password": {"pa$$word"}})
+	if code != http.StatusTooManyRequests || header.Get("Retry-After") != "3600" {
+		t.Errorf("right password after the lockout: got %d with Retry-After %q", code, header.Get("Retry-After"))
+	}
+	if _, err := app.twoFactor.Get(1); err != nil {
+		t.Errorf("two-factor authentication was turned off: %v", err)
+	}
+
+	if n := len(app.mailer.(*testMailer).messages(app)); n != 1 {
+		t.Errorf("got %d emails, want 1", n)
+	}
+}
@@ -0,0 +1,232 @@
+// Package diff compares the revisions of snippets line by line, and formats
+// the differences as the hunks of a unified diff.
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// maxCells bounds the size of the table that Lines fills in to compare the
+// changed lines of two texts, whose cost is their number multiplied together.
+// Without it, two long texts could take gigabytes of memory to compare.
+const maxCells = 1_000_000
+
+// ErrTooLarge is returned when two texts have too many changed lines to be
+// compared.
+var ErrTooLarge = errors.New("diff: too many changed lines to compare")
+
+// Op is the kind of change a Line represents.
+type Op int
+
+const (
+	Equal Op = iota
+	Insert
+	Delete
+)
+
+// String returns the name of op. It doubles as a CSS class name in templates.
+func (op Op) String() string {
+	switch op {
+	case Insert:
+		return "insert"
+	case Delete:
+		return "delete"
+	default:
+		return "equal"
+	}
+}
+
+// Line is a single line of a diff. OldNumber and NewNumber are the 1-based
+// line numbers in the old and new text, and are 0 when the line does not
+// exist on that side.
+type Line struct {
+	Op        Op
+	Text      string
+	OldNumber int
+	NewNumber int
+}
+
+// Prefix returns the character that precedes the line in a unified diff.
+func (l Line) Prefix() string {
+	switch l.Op {
+	case Insert:
+		return "+"
+	case Delete:
+		return "-"
+	default:
+		return " "
+	}
+}
+
+// Hunk is a group of changed lines together with their surrounding context.
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Lines    []Line
+}
+
+// Header returns the "@@ -l,s +l,s @@" range header of the hunk.
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+}
+
+// Unified compares a and b line by line and returns the hunks of a unified
+// diff, with up to context unchanged lines around every change. It returns
+// nil if a and b are the same, and ErrTooLarge like Lines.
+func Unified(a, b string, context int) ([]Hunk, error) {
+	lines, err := Lines(a, b)
+	if err != nil {
+		return nil, err
+	}
+
+	var hunks []Hunk
+	for i := 0; i < len(lines); {
+		if lines[i].Op == Equal {
+			i++
+			continue
+		}
+
+		// Extend the hunk backwards by up to context lines, then forwards until
+		// we reach a run of more than 2*context unchanged lines or the end
+		start := max(i-context, 0)
+		end := i
+		for end < len(lines) {
+			if lines[end].Op != Equal {
+				end++
+				continue
+			}
+
+			run := end
+			for run < len(lines) && lines[run].Op == Equal {
+				run++
+			}
+			if run == len(lines) || run-end > 2*context {
+				end = min(end+context, len(lines))
+				break
+			}
+			end = run
+		}
+
+		hunks = append(hunks, newHunk(lines, start, end))
+		i = end
+	}
+
+	return hunks, nil
+}
+
+// newHunk builds a Hunk from lines[start:end] and computes its range header.
+func newHunk(lines []Line, start, end int) Hunk {
+	h := Hunk{Lines: lines[start:end]}
+
+	// Count the lines on each side that come before the hunk
+	for _, l := range lines[:start] {
+		if l.OldNumber > 0 {
+			h.OldStart++
+		}
+		if l.NewNumber > 0 {
+			h.NewStart++
+		}
+	}
+
+	for _, l := range h.Lines {
+		if l.OldNumber > 0 {
+			h.OldLines++
+		}
+		if l.NewNumber > 0 {
+			h.NewLines++
+		}
+	}
+
+	// By convention, an empty range starts at the line before it
+	if h.OldLines > 0 {
+		h.OldStart++
+	}
+	if h.NewLines > 0 {
+		h.NewStart++
+	}
+
+	return h
+}
+
+// Lines compares a and b line by line and returns every line of both texts,
+// marked as unchanged, inserted or deleted. It uses the longest common
+// subsequence of lines, so the cost is proportional to the number of changed
+// lines in a multiplied by those in b, leaving out the lines that both texts
+// start and end with. It returns ErrTooLarge if that would be too costly.
+func Lines(a, b string) ([]Line, error) {
+	x, y := split(a), split(b)
+
+	// Most edits leave the start and the end of a text alone, so only the
+	// lines in between need to be compared
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix && x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+
+	mx, my := x[prefix:len(x)-suffix], y[prefix:len(y)-suffix]
+	if (len(mx)+1)*(len(my)+1) > maxCells {
+		return nil, ErrTooLarge
+	}
+
+	lines := make([]Line, 0, len(x)+len(my))
+	for i := range prefix {
+		lines = append(lines, Line{Op: Equal, Text: x[i], OldNumber: i + 1, NewNumber: i + 1})
+	}
+
+	// lcs[i][j] holds the length of the longest common subsequence of mx[i:] and my[j:]
+	lcs := make([][]int, len(mx)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(my)+1)
+	}
+	for i := len(mx) - 1; i >= 0; i-- {
+		for j := len(my) - 1; j >= 0; j-- {
+			if mx[i] == my[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(mx) || j < len(my) {
+		switch {
+		case i < len(mx) && j < len(my) && mx[i] == my[j]:
+			lines = append(lines, Line{Op: Equal, Text: mx[i], OldNumber: prefix + i + 1, NewNumber: prefix + j + 1})
+			i++
+			j++
+		case i < len(mx) && (j == len(my) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, Line{Op: Delete, Text: mx[i], OldNumber: prefix + i + 1})
+			i++
+		default:
+			lines = append(lines, Line{Op: Insert, Text: my[j], NewNumber: prefix + j + 1})
+			j++
+		}
+	}
+
+	for k := range suffix {
+		i, j := len(x)-suffix+k, len(y)-suffix+k
+		lines = append(lines, Line{Op: Equal, Text: x[i], OldNumber: i + 1, NewNumber: j + 1})
+	}
+
+	return lines, nil
+}
+
+// split breaks s into lines. Line endings submitted by browsers (\r\n) are
+// treated the same as \n, and a trailing newline does not add an empty line.
+func split(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,153 @@
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// numbered returns a text with the lines "1" to "n", where the lines in
+// changes are replaced by their values.
+func numbered(n int, changes map[int]string) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		if line, ok := changes[i]; ok {
+			b.WriteString(line + "\n")
+		} else {
+			fmt.Fprintf(&b, "%d\n", i)
+		}
+	}
+	return b.String()
+}
+
+func TestLines(t *testing.T) {
+	got, err := Lines("a\nb\nc\nd\n", "a\nc\nx\nd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Line{
+		{Op: Equal, Text: "a", OldNumber: 1, NewNumber: 1},
+		{Op: Delete, Text: "b", OldNumber: 2},
+		{Op: Equal, Text: "c", OldNumber: 3, NewNumber: 2},
+		{Op: Insert, Text: "x", NewNumber: 3},
+		{Op: Equal, Text: "d", OldNumber: 4, NewNumber: 4},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestLinesEmpty(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want []Line
+	}{
+		{"", "", []Line{}},
+		{"", "a\n", []Line{{Op: Insert, Text: "a", NewNumber: 1}}},
+		{"a\r\nb\r\n", "a\nb", []Line{
+			{Op: Equal, Text: "a", OldNumber: 1, NewNumber: 1},
+			{Op: Equal, Text: "b", OldNumber: 2, NewNumber: 2},
+		}},
+	}
+
+	for _, tt := range tests {
+		got, err := Lines(tt.a, tt.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q to %q: got %+v, want %+v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestLinesTooLarge(t *testing.T) {
+	// A single change in long texts is cheap to compare, as only the changed
+	// lines are
+	a := numbered(30_000, nil)
+	lines, err := Lines(a, numbered(30_000, map[int]string{15_000: "changed"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 30_001 {
+		t.Errorf("got %d lines, want 30001", len(lines))
+	}
+
+	changes := make(map[int]string)
+	for i := 2; i < 30_000; i++ {
+		changes[i] = "changed"
+	}
+	_, err = Lines(a, numbered(30_000, changes))
+	if !errors.Is(err, ErrTooLarge) {
+		t.Errorf("got %v, want ErrTooLarge", err)
+	}
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name    string
+		changes map[int]string
+		want    []string // headers of the hunks
+	}{
+		{"none", nil, nil},
+		{"one", map[int]string{10: "x"}, []string{"@@ -7,7 +7,7 @@"}},
+		{"at the start", map[int]string{1: "x"}, []string{"@@ -1,4 +1,4 @@"}},
+		{"at the end", map[int]string{30: "x"}, []string{"@@ -27,4 +27,4 @@"}},
+		// Changes with up to 2*context unchanged lines between them share a
+		// hunk
+		{"merged", map[int]string{10: "x", 17: "y"}, []string{"@@ -7,14 +7,14 @@"}},
+		{"apart", map[int]string{10: "x", 18: "y"}, []string{"@@ -7,7 +7,7 @@", "@@ -15,7 +15,7 @@"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hunks, err := Unified(numbered(30, nil), numbered(30, tt.changes), 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, h := range hunks {
+				got = append(got, h.Header())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnifiedInsert(t *testing.T) {
+	hunks, err := Unified("a\nb\n", "a\nx\nb\n", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hunks) != 1 {
+		t.Fatalf("got %d hunks, want 1", len(hunks))
+	}
+
+	h := hunks[0]
+	if h.Header() != "@@ -1,2 +1,3 @@" {
+		t.Errorf("got header %q", h.Header())
+	}
+
+	var got []string
+	for _, l := range h.Lines {
+		got = append(got, l.Prefix()+l.Text)
+	}
+	if want := []string{" a", "+x", " b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// An empty range starts at the line before it
+	hunks, err = Unified("", "a\n", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hunks[0].Header(); got != "@@ -0,0 +1,1 @@" {
+		t.Errorf("got header %q for an empty old text", got)
+	}
+}
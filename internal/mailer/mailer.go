@@ -0,0 +1,206 @@
+// Package mailer sends the emails of the application, such as password reset
+// links. SMTP delivers them, while File and Log only keep them locally, for
+// development and tests.
+package mailer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email to a single recipient.
+type Message struct {
+	To      string // address of the recipient, e.g. "alice@example.com"
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// Compile-time checks that the mailers implement the interface.
+var (
+	_ Mailer = (*SMTP)(nil)
+	_ Mailer = (*File)(nil)
+	_ Mailer = (*Log)(nil)
+)
+
+// smtpTimeout bounds the whole conversation with the SMTP server, so that an
+// unresponsive server can't hold up a send forever.
+const smtpTimeout = 30 * time.Second
+
+// SMTP sends emails through an SMTP server. The connection is upgraded with
+// STARTTLS when the server supports it, and net/smtp refuses to send the
+// password over an unencrypted connection, except to localhost.
+type SMTP struct {
+	Addr     string // host:port of the server
+	Username string // no authentication if empty
+	Password string
+	From     string // e.g. "Snippetbox <no-reply@example.com>"
+}
+
+// Send sends msg through the SMTP server.
+func (m *SMTP) Send(msg Message) error {
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return fmt.Errorf("mailer: sender %q: %w", m.From, err)
+	}
+
+	data, err := format(m.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	host, _, err := net.SplitHostPort(m.Addr)
+	if err != nil {
+		return fmt.Errorf("mailer: %w", err)
+	}
+
+	conn, err := net.DialTimeout("tcp", m.Addr, smtpTimeout)
+	if err != nil {
+		return fmt.Errorf("mailer: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("mailer: %w", err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("mailer: %w", err)
+		}
+	}
+
+	if m.Username != "" {
+		if err = c.Auth(smtp.PlainAuth("", m.Username, m.Password, host)); err != nil {
+			return fmt.Errorf("mailer: %w", err)
+		}
+	}
+
+	if err = c.Mail(from.Address); err != nil {
+		return fmt.Errorf("mailer: %w", err)
+	}
+	if err = c.Rcpt(msg.To); err != nil {
+		return fmt.Errorf("mailer: %w", err)
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("mailer: %w", err)
+	}
+	if _, err = w.Write(data); err != nil {
+		return fmt.Errorf("mailer: %w", err)
+	}
+	if err = w.Close(); err != nil {
+		return fmt.Errorf("mailer: %w", err)
+	}
+
+	return c.Quit()
+}
+
+// File writes every email to a new file in Dir instead of sending it, for
+// local development and tests. The files hold the messages as they would have
+// been sent, and are named after the time they were written and their
+// recipient, e.g. "20260102T150405.000000000Z-alice@example.com.eml".
+type File struct {
+	Dir  string // created if it doesn't exist
+	From string
+}
+
+// Send writes msg to a new file in m.Dir.
+func (m *File) Send(msg Message) error {
+	data, err := format(m.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(m.Dir, 0o700); err != nil {
+		return fmt.Errorf("mailer: %w", err)
+	}
+
+	// The local part of an address may contain a slash, which must not lead
+	// the file out of m.Dir
+	name := time.Now().UTC().Format("20060102T150405.000000000Z") + "-" + filepath.Base(msg.To) + ".eml"
+
+	err = os.WriteFile(filepath.Join(m.Dir, name), data, 0o600)
+	if err != nil {
+		return fmt.Errorf("mailer: %w", err)
+	}
+	return nil
+}
+
+// Log writes every email to Logger instead of sending it, for local
+// development.
+type Log struct {
+	Logger *log.Logger
+}
+
+// Send logs msg.
+func (m *Log) Send(msg Message) error {
+	if err := checkAddress(msg.To); err != nil {
+		return err
+	}
+
+	m.Logger.Printf("Email to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// checkAddress returns an error unless to is a single bare email address,
+// which can safely be put in a header.
+func checkAddress(to string) error {
+	addr, err := mail.ParseAddress(to)
+	if err != nil || addr.Address != to {
+		return fmt.Errorf("mailer: invalid recipient %q", to)
+	}
+	return nil
+}
+
+// format returns msg as an RFC 5322 message from the given sender, with its
+// body in quoted-printable, so that long lines and non-ASCII text survive.
+func format(from string, msg Message, date time.Time) ([]byte, error) {
+	if err := checkAddress(msg.To); err != nil {
+		return nil, err
+	}
+	if strings.ContainsAny(from+msg.Subject, "\r\n") {
+		return nil, errors.New("mailer: header contains a line break")
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	b.WriteString("\r\n")
+
+	w := quotedprintable.NewWriter(&b)
+	body := strings.ReplaceAll(msg.Body, "\r\n", "\n")
+	if _, err := w.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
@@ -0,0 +1,50 @@
+// Package markdown renders the content of markdown snippets as HTML which is
+// safe to show to other users.
+package markdown
+
+import (
+	"bytes"
+	"html/template"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// converter converts GitHub Flavored Markdown to HTML. It isn't given the
+// html.WithUnsafe option, so raw HTML in the source is left out and links to
+// dangerous URLs, such as javascript: URLs, have their destination removed.
+var converter = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+)
+
+// policy sanitizes the converted HTML. The converter should already leave out
+// anything unsafe, but snippets are written by anyone, so the HTML is checked
+// again against a list of elements and attributes that are known to be safe.
+var policy = newPolicy()
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+
+	// Task list items are rendered as disabled checkboxes
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+
+	// Fenced code blocks keep their language, e.g. class="language-go"
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#-]+$`)).OnElements("code")
+
+	return p
+}
+
+// Render converts the markdown source to sanitized HTML.
+func Render(source string) (template.HTML, error) {
+	var buf bytes.Buffer
+
+	err := converter.Convert([]byte(source), &buf)
+	if err != nil {
+		return "", err
+	}
+
+	return template.HTML(policy.SanitizeBytes(buf.Bytes())), nil
+}
@@ -0,0 +1,296 @@
+package markdown
+
+import (
+	"html"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{
+			name:   "Heading",
+			source: "# Title",
+			want:   "<h1>Title</h1>",
+		},
+		{
+			name:   "Emphasis",
+			source: "*a* **b** ~~c~~",
+			want:   "<p><em>a</em> <strong>b</strong> <del>c</del></p>",
+		},
+		{
+			name:   "Code block",
+			source: "```go\nif a < b {}\n```",
+			want:   `<pre><code class="language-go">if a &lt; b {}`,
+		},
+		{
+			name:   "Link",
+			source: "[Go](https://go.dev)",
+			want:   `<a href="https://go.dev" rel="nofollow">Go</a>`,
+		},
+		{
+			name:   "Relative link",
+			source: "[snippet](/snippet/view/1)",
+			want:   `<a href="/snippet/view/1" rel="nofollow">snippet</a>`,
+		},
+		{
+			name:   "Table",
+			source: "| a |\n|---|\n| b |",
+			want:   "<td>b</td>",
+		},
+		{
+			name:   "Task list",
+			source: "- [x] done",
+			want:   `<input checked="" disabled="" type="checkbox"> done`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.Contains(string(got), tt.want) {
+				t.Errorf("got %q; want it to contain %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderXSS(t *testing.T) {
+	// Each payload tries to run a script, and must not leave any of the
+	// forbidden strings in the output. The output is unescaped and lowercased
+	// before it is checked, so that encoded and mixed-case variants are caught.
+	tests := []struct {
+		name      string
+		source    string
+		forbidden []string
+	}{
+		{
+			name:      "Script element",
+			source:    "<script>alert(1)</script>",
+			forbidden: []string{"<script"},
+		},
+		{
+			name:      "Script element inside a paragraph",
+			source:    "Hello <script>alert(1)</script> world",
+			forbidden: []string{"<script"},
+		},
+		{
+			name:      "Event handler attribute",
+			source:    `<img src="x" onerror="alert(1)">`,
+			forbidden: []string{"onerror"},
+		},
+		{
+			name:      "SVG onload",
+			source:    `<svg onload="alert(1)"></svg>`,
+			forbidden: []string{"<svg", "onload"},
+		},
+		{
+			name:      "Raw link with a javascript URL",
+			source:    `<a href="javascript:alert(1)">x</a>`,
+			forbidden: []string{"javascript:"},
+		},
+		{
+			name:      "Iframe",
+			source:    `<iframe src="https://example.com"></iframe>`,
+			forbidden: []string{"<iframe"},
+		},
+		{
+			name:      "Style element",
+			source:    "<style>body { display: none }</style>",
+			forbidden: []string{"<style"},
+		},
+		{
+			name:      "Style attribute",
+			source:    `<div style="background: url(javascript:alert(1))">x</div>`,
+			forbidden: []string{"style=", "javascript:"},
+		},
+		{
+			name:      "Markdown link with a javascript URL",
+			source:    "[x](javascript:alert(1))",
+			forbidden: []string{"javascript:"},
+		},
+		{
+			name:      "Mixed-case javascript URL",
+			source:    "[x](JaVaScRiPt:alert(1))",
+			forbidden: []string{"javascript:"},
+		},
+		{
+			name:      "Entity-encoded javascript URL",
+			source:    "[x](&#106;avascript:alert(1))",
+			forbidden: []string{"javascript:"},
+		},
+		{
+			name:      "Percent-encoded javascript URL",
+			source:    "[x](%6Aavascript:alert(1))",
+			forbidden: []string{"javascript:", "%6aavascript:"},
+		},
+		{
+			name:      "Javascript URL with a tab",
+			source:    "[x](java&#9;script:alert(1))",
+			forbidden: []string{"javascript:", "java\tscript:"},
+		},
+		{
+			name:      "Reference link with a javascript URL",
+			source:    "[x][1]\n\n[1]: javascript:alert(1)",
+			forbidden: []string{"javascript:"},
+		},
+		{
+			name:      "Autolink with a javascript URL",
+			source:    "<javascript:alert(1)>",
+			forbidden: []string{`href="javascript:`},
+		},
+		{
+			name:      "Image with a javascript URL",
+			source:    "![x](javascript:alert(1))",
+			forbidden: []string{"javascript:"},
+		},
+		{
+			name:      "Vbscript URL",
+			source:    "[x](vbscript:msgbox(1))",
+			forbidden: []string{"vbscript:"},
+		},
+		{
+			name:      "Data URL",
+			source:    "[x](data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==)",
+			forbidden: []string{"data:"},
+		},
+		{
+			name:      "Link title breaking out of its attribute",
+			source:    `[x](https://example.com "a\" onmouseover=\"alert(1)")`,
+			forbidden: []string{"onmouseover="},
+		},
+		{
+			name:      "Class attribute on a code block",
+			source:    "```\" onclick=\"alert(1)\nx\n```",
+			forbidden: []string{"onclick"},
+		},
+		{
+			name:      "HTML comment hiding a script",
+			source:    "<!-- --><script>alert(1)</script> -->",
+			forbidden: []string{"<script"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			output := strings.ToLower(html.UnescapeString(string(got)))
+			for _, s := range tt.forbidden {
+				if strings.Contains(output, s) {
+					t.Errorf("got %q; want it not to contain %q", got, s)
+				}
+			}
+		})
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	// The converter already leaves out raw HTML, so the payloads are given to
+	// the policy directly, to check that it would catch them on its own.
+	tests := []struct {
+		name      string
+		html      string
+		forbidden []string
+	}{
+		{
+			name:      "Script element",
+			html:      "<p>a<script>alert(1)</script></p>",
+			forbidden: []string{"<script", "alert"},
+		},
+		{
+			name:      "Event handler attribute",
+			html:      `<img src="/x.png" onerror="alert(1)">`,
+			forbidden: []string{"onerror"},
+		},
+		{
+			name:      "Javascript URL",
+			html:      `<a href="javascript:alert(1)">x</a>`,
+			forbidden: []string{"javascript:"},
+		},
+		{
+			name:      "Entity-encoded javascript URL",
+			html:      `<a href="&#106;&#97;&#118;&#97;&#115;&#99;&#114;&#105;&#112;&#116;&#58;alert(1)">x</a>`,
+			forbidden: []string{"javascript:"},
+		},
+		{
+			name:      "Javascript URL with whitespace",
+			html:      "<a href=\" \tjavascript:alert(1)\">x</a>",
+			forbidden: []string{"javascript:"},
+		},
+		{
+			name:      "Data URL",
+			html:      `<a href="data:text/html,<script>alert(1)</script>">x</a>`,
+			forbidden: []string{"data:", "<script"},
+		},
+		{
+			name:      "Iframe",
+			html:      `<iframe src="https://example.com"></iframe>`,
+			forbidden: []string{"<iframe"},
+		},
+		{
+			name:      "Object and embed",
+			html:      `<object data="x.swf"></object><embed src="x.swf">`,
+			forbidden: []string{"<object", "<embed"},
+		},
+		{
+			name:      "Form",
+			html:      `<form action="https://example.com"><button>Go</button></form>`,
+			forbidden: []string{"<form", "<button"},
+		},
+		{
+			name:      "Meta refresh",
+			html:      `<meta http-equiv="refresh" content="0;url=javascript:alert(1)">`,
+			forbidden: []string{"<meta", "javascript:"},
+		},
+		{
+			name:      "Style attribute",
+			html:      `<p style="background: url(javascript:alert(1))">x</p>`,
+			forbidden: []string{"style=", "javascript:"},
+		},
+		{
+			name:      "Text input",
+			html:      `<input type="text" autofocus onfocus="alert(1)">`,
+			forbidden: []string{`type="text"`, "autofocus", "onfocus"},
+		},
+		{
+			name:      "Checkbox with an event handler",
+			html:      `<input type="checkbox" disabled onclick="alert(1)">`,
+			forbidden: []string{"onclick"},
+		},
+		{
+			name:      "Code class with an extra attribute",
+			html:      `<code class="language-go" onmouseover="alert(1)">x</code>`,
+			forbidden: []string{"onmouseover"},
+		},
+		{
+			name:      "Code class that isn't a language",
+			html:      `<code class="language-go x">x</code>`,
+			forbidden: []string{"class="},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := policy.Sanitize(tt.html)
+
+			output := strings.ToLower(html.UnescapeString(got))
+			for _, s := range tt.forbidden {
+				if strings.Contains(output, s) {
+					t.Errorf("got %q; want it not to contain %q", got, s)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,342 @@
+// Package migrate applies and rolls back versioned schema migrations, and
+// records the applied versions in the schema_migrations table.
+package migrate
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoChange is returned by Down when there is no migration to roll back.
+var ErrNoChange = errors.New("migrate: no migration to roll back")
+
+// Migration is a single versioned change to the schema.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string // SQL that applies the migration
+	Down    string // SQL that reverts the migration
+}
+
+// String returns the migration's file name prefix, e.g. "0001_create_snippets".
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// Status describes whether a migration has been applied.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time // zero if the migration has not been applied
+}
+
+// Load reads the migrations in dir of fsys, ordered by version. Every migration
+// must have both an up and a down file, named <version>_<name>.up.sql and
+// <version>_<name>.down.sql.
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		name := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		prefix, label, ok := strings.Cut(strings.TrimSuffix(name, "."+direction+".sql"), "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version < 1 {
+			return nil, fmt.Errorf("migrate: invalid migration file name %q", name)
+		}
+
+		b, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		} else if m.Name != label {
+			return nil, fmt.Errorf("migrate: version %d is used by both %q and %q", version, m.Name, label)
+		}
+
+		if direction == "up" {
+			m.Up = string(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migrate: %s must have both an up and a down file", m)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Migrator applies Migrations to DB.
+type Migrator struct {
+	DB         *sql.DB
+	Migrations []Migration // ordered by version, as returned by Load
+}
+
+// init creates the schema_migrations table if it doesn't exist yet. The SQL
+// works on both MySQL and SQLite.
+func (m *Migrator) init() error {
+	stmt := `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER NOT NULL PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied DATETIME NOT NULL
+	)`
+
+	_, err := m.DB.Exec(stmt)
+	return err
+}
+
+// applied returns the time each applied version was applied at.
+func (m *Migrator) applied() (map[int]time.Time, error) {
+	if err := m.init(); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.DB.Query("SELECT version, applied FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+// Status returns every migration and whether it has been applied.
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.Migrations))
+	for _, migration := range m.Migrations {
+		at, ok := applied[migration.Version]
+		statuses = append(statuses, Status{Migration: migration, Applied: ok, AppliedAt: at})
+	}
+
+	return statuses, nil
+}
+
+// Up applies every migration that has not been applied yet, in order, and
+// returns the ones it applied. It stops at the first migration that fails.
+func (m *Migrator) Up() ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range m.Migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		err := m.run(migration.Up, func(tx *sql.Tx) error {
+			stmt := "INSERT INTO schema_migrations (version, name, applied) VALUES (?, ?, ?)"
+			_, err := tx.Exec(stmt, migration.Version, migration.Name, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("migrate: applying %s: %w", migration, err)
+		}
+
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// Down reverts the most recently applied migration and returns it. It returns
+// ErrNoChange if no migration has been applied.
+func (m *Migrator) Down() (*Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(m.Migrations) - 1; i >= 0; i-- {
+		migration := m.Migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+
+		err := m.run(migration.Down, func(tx *sql.Tx) error {
+			_, err := tx.Exec("DELETE FROM schema_migrations WHERE version = ?", migration.Version)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("migrate: reverting %s: %w", migration, err)
+		}
+
+		return &migration, nil
+	}
+
+	return nil, ErrNoChange
+}
+
+// Force records every migration up to and including version as applied, and
+// every later one as not applied, without running any SQL. It is meant for
+// databases whose tables were created by hand before migrations existed.
+func (m *Migrator) Force(version int) error {
+	if err := m.init(); err != nil {
+		return err
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("DELETE FROM schema_migrations"); err != nil {
+		return err
+	}
+
+	for _, migration := range m.Migrations {
+		if migration.Version > version {
+			break
+		}
+
+		stmt := "INSERT INTO schema_migrations (version, name, applied) VALUES (?, ?, ?)"
+		_, err = tx.Exec(stmt, migration.Version, migration.Name, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// run executes the statements in script followed by record inside a single
+// transaction. On SQLite a failed migration is rolled back as a whole. MySQL
+// commits every schema change implicitly, so there a failure can leave a
+// migration partly applied and it has to be fixed by hand.
+func (m *Migrator) run(script string, record func(*sql.Tx) error) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range split(script) {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	if err = record(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// split breaks a script into its statements, so that drivers which only run
+// one statement per Exec (like MySQL by default) can run it. Semicolons end a
+// statement unless they are inside quotes or the BEGIN ... END body of a
+// CREATE TRIGGER, and "--" comments are dropped.
+func split(script string) []string {
+	var statements []string
+	var current strings.Builder
+	var quote rune
+
+	for _, line := range strings.Split(script, "\n") {
+		if quote == 0 && strings.HasPrefix(strings.TrimSpace(line), "--") {
+			continue
+		}
+
+		for _, r := range line {
+			switch {
+			case quote != 0:
+				if r == quote {
+					quote = 0
+				}
+			case r == '\'' || r == '"' || r == '`':
+				quote = r
+			case r == ';' && !inTriggerBody(current.String()):
+				if stmt := strings.TrimSpace(current.String()); stmt != "" {
+					statements = append(statements, stmt)
+				}
+				current.Reset()
+				continue
+			}
+			current.WriteRune(r)
+		}
+		current.WriteRune('\n')
+	}
+
+	if stmt := strings.TrimSpace(current.String()); stmt != "" {
+		statements = append(statements, stmt)
+	}
+
+	return statements
+}
+
+// inTriggerBody reports whether stmt, the start of a statement, is a CREATE
+// TRIGGER whose body hasn't ended yet. The semicolons in the body belong to
+// the trigger's own statements.
+func inTriggerBody(stmt string) bool {
+	words := strings.Fields(strings.ToUpper(stmt))
+	if len(words) < 2 || words[0] != "CREATE" {
+		return false
+	}
+
+	// CREATE [TEMP|TEMPORARY] TRIGGER
+	i := 1
+	if words[i] == "TEMP" || words[i] == "TEMPORARY" {
+		i++
+	}
+	if i >= len(words) || words[i] != "TRIGGER" {
+		return false
+	}
+
+	return words[len(words)-1] != "END"
+}
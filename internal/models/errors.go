@@ -5,7 +5,8 @@ import (
 )
 
 var (
-	ErrNoRecord           = errors.New("models: no matching record found")
-	ErrInvalidCredentials = errors.New("models: invalid credentials")
-	ErrDuplicateEmail     = errors.New("models: duplicate email")
+	ErrNoRecord            = errors.New("models: no matching record found")
+	ErrInvalidCredentials  = errors.New("models: invalid credentials")
+	ErrDuplicateEmail      = errors.New("models: duplicate email")
+	ErrDuplicateCredential = errors.New("models: duplicate credential")
 )
@@ -0,0 +1,56 @@
+// Package memory implements the storage interfaces of the models package in
+// memory. Nothing is persisted, which makes it useful for local development
+// and hermetic tests, but not for production.
+package memory
+
+import (
+	"sync"
+
+	"github.com/mgxnch/snippetbox/internal/models"
+)
+
+// DB holds the data of every in-memory model, guarded by a single mutex the
+// way a database would serialise conflicting writes. Models share a DB so that
+// e.g. snippets can look up the names of their authors.
+type DB struct {
+	mu sync.RWMutex
+
+	snippets  map[int]*models.Snippet
+	revisions map[int][]*models.Revision // keyed by snippet ID, oldest first
+	users     map[int]*models.User
+	tokens    map[int]*token
+	resets    map[int]*passwordReset
+	twoFactor map[int]*twoFactor // keyed by user ID
+	passkeys  map[int]*models.Passkey
+	archive   []*models.Snippet // snippets moved out by SnippetModel.PurgeExpired
+
+	// The last ID handed out for each kind of record, like AUTO_INCREMENT
+	lastSnippetID  int
+	lastRevisionID int
+	lastUserID     int
+	lastTokenID    int
+	lastResetID    int
+	lastPasskeyID  int
+}
+
+// New returns an empty DB.
+func New() *DB {
+	return &DB{
+		snippets:  make(map[int]*models.Snippet),
+		revisions: make(map[int][]*models.Revision),
+		users:     make(map[int]*models.User),
+		tokens:    make(map[int]*token),
+		resets:    make(map[int]*passwordReset),
+		twoFactor: make(map[int]*twoFactor),
+		passkeys:  make(map[int]*models.Passkey),
+	}
+}
+
+// authorName returns the name of the user with id, or "" if there is no such
+// user. The caller must hold db.mu.
+func (db *DB) authorName(id int) string {
+	if u, ok := db.users[id]; ok {
+		return u.Name
+	}
+	return ""
+}
@@ -0,0 +1,109 @@
+package memory
+
+import (
+	"bytes"
+	"sort"
+	"time"
+
+	"github.com/mgxnch/snippetbox/internal/models"
+)
+
+// PasskeyModel implements models.PasskeyStore.
+type PasskeyModel struct {
+	DB *DB
+}
+
+var _ models.PasskeyStore = (*PasskeyModel)(nil)
+
+// Insert adds the passkey p of the user p.UserID, and returns its ID. It
+// returns models.ErrDuplicateCredential if a passkey with the same credential
+// ID has already been added.
+func (m *PasskeyModel) Insert(p *models.Passkey) (int, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	for _, other := range m.DB.passkeys {
+		if bytes.Equal(other.CredentialID, p.CredentialID) {
+			return 0, models.ErrDuplicateCredential
+		}
+	}
+
+	m.DB.lastPasskeyID++
+	c := *p
+	c.ID = m.DB.lastPasskeyID
+	c.Created = time.Now().UTC()
+	c.LastUsed = time.Time{}
+	m.DB.passkeys[c.ID] = &c
+
+	return c.ID, nil
+}
+
+// ForUser returns every passkey of the user with userID, oldest first.
+func (m *PasskeyModel) ForUser(userID int) ([]*models.Passkey, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	var passkeys []*models.Passkey
+	for _, p := range m.DB.passkeys {
+		if p.UserID == userID {
+			c := *p
+			passkeys = append(passkeys, &c)
+		}
+	}
+
+	sort.Slice(passkeys, func(i, j int) bool {
+		return passkeys[i].ID < passkeys[j].ID
+	})
+	return passkeys, nil
+}
+
+// Use records that the passkey with id has just been used to log in, and that
+// its authenticator's signature counter is now signCount. It returns
+// models.ErrInvalidCredentials if the counter hasn't gone up since the last
+// login, which means that the passkey may have been cloned, unless the
+// authenticator has no counter and always reports 0. Only one of several
+// concurrent calls with the same counter succeeds.
+func (m *PasskeyModel) Use(id int, signCount uint32) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	p, ok := m.DB.passkeys[id]
+	if !ok || !(p.SignCount < signCount || (p.SignCount == 0 && signCount == 0)) {
+		return models.ErrInvalidCredentials
+	}
+	p.SignCount = signCount
+	p.LastUsed = time.Now().UTC()
+
+	return nil
+}
+
+// Rename changes the name of the passkey with the specified id, if it belongs
+// to the user with userID. It returns models.ErrNoRecord if there is no such
+// passkey.
+func (m *PasskeyModel) Rename(id, userID int, name string) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	p, ok := m.DB.passkeys[id]
+	if !ok || p.UserID != userID {
+		return models.ErrNoRecord
+	}
+	p.Name = name
+
+	return nil
+}
+
+// Revoke deletes the passkey with the specified id, if it belongs to the user
+// with userID. It returns models.ErrNoRecord if there is no such passkey.
+func (m *PasskeyModel) Revoke(id, userID int) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	p, ok := m.DB.passkeys[id]
+	if !ok || p.UserID != userID {
+		return models.ErrNoRecord
+	}
+
+	delete(m.DB.passkeys, id)
+	return nil
+}
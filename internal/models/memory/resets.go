@@ -0,0 +1,104 @@
+package memory
+
+import (
+	"time"
+
+	"github.com/mgxnch/snippetbox/internal/models"
+)
+
+// passwordReset is a stored models.PasswordReset together with the hash of
+// its plaintext.
+type passwordReset struct {
+	models.PasswordReset
+	hash string
+}
+
+// PasswordResetModel implements models.PasswordResetStore.
+type PasswordResetModel struct {
+	DB *DB
+}
+
+var _ models.PasswordResetStore = (*PasswordResetModel)(nil)
+
+// Insert creates a reset token for the user with userID, which expires after
+// ttl, and returns its plaintext. The user's earlier tokens are deleted, so
+// that only the newest link works.
+func (m *PasswordResetModel) Insert(userID int, ttl time.Duration) (string, error) {
+	plaintext, err := models.GenerateResetToken()
+	if err != nil {
+		return "", err
+	}
+
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	m.DB.deleteResets(userID)
+
+	m.DB.lastResetID++
+	r := &passwordReset{
+		PasswordReset: models.PasswordReset{
+			ID:      m.DB.lastResetID,
+			UserID:  userID,
+			Created: time.Now().UTC(),
+		},
+		hash: models.HashToken(plaintext),
+	}
+	r.Expires = r.Created.Add(ttl)
+	m.DB.resets[r.ID] = r
+
+	return plaintext, nil
+}
+
+// Get looks up the unexpired reset token with the given plaintext. It returns
+// models.ErrInvalidCredentials if there is no such token.
+func (m *PasswordResetModel) Get(plaintext string) (*models.PasswordReset, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	r := m.DB.reset(models.HashToken(plaintext))
+	if r == nil {
+		return nil, models.ErrInvalidCredentials
+	}
+
+	c := r.PasswordReset
+	return &c, nil
+}
+
+// Redeem uses up the unexpired reset token with the given plaintext, and
+// returns the ID of its user. It returns models.ErrInvalidCredentials if there
+// is no such token. Only one of several concurrent calls with the same token
+// succeeds.
+func (m *PasswordResetModel) Redeem(plaintext string) (int, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	r := m.DB.reset(models.HashToken(plaintext))
+	if r == nil {
+		return 0, models.ErrInvalidCredentials
+	}
+
+	m.DB.deleteResets(r.UserID)
+
+	return r.UserID, nil
+}
+
+// reset returns the unexpired reset token with the given hash, or nil if there
+// is none. The caller must hold db.mu.
+func (db *DB) reset(hash string) *passwordReset {
+	for _, r := range db.resets {
+		if r.hash == hash && r.Expires.After(time.Now()) {
+			return r
+		}
+	}
+	return nil
+}
+
+// deleteResets deletes every reset token of the user with userID. The caller
+// must hold db.mu for writing.
+func (db *DB) deleteResets(userID int) {
+	for id, r := range db.resets {
+		if r.UserID == userID {
+			delete(db.resets, id)
+		}
+	}
+}
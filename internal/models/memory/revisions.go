@@ -0,0 +1,80 @@
+package memory
+
+import (
+	"time"
+
+	"github.com/mgxnch/snippetbox/internal/models"
+)
+
+// insertRevision adds the next revision of the snippet with snippetID. The
+// caller must hold db.mu for writing.
+func (db *DB) insertRevision(snippetID, userID int, title, content string) {
+	db.lastRevisionID++
+	db.revisions[snippetID] = append(db.revisions[snippetID], &models.Revision{
+		ID:        db.lastRevisionID,
+		SnippetID: snippetID,
+		Version:   len(db.revisions[snippetID]) + 1,
+		UserID:    userID,
+		Title:     title,
+		Content:   content,
+		Created:   time.Now().UTC(),
+	})
+}
+
+// revision returns a copy of the stored revision r with its author filled in.
+// The caller must hold db.mu.
+func (db *DB) revision(r *models.Revision) *models.Revision {
+	c := *r
+	c.Author = db.authorName(c.UserID)
+	return &c
+}
+
+// Revisions returns every revision of the snippet with snippetID, newest first.
+func (m *SnippetModel) Revisions(snippetID int) ([]*models.Revision, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	stored := m.DB.revisions[snippetID]
+
+	revisions := make([]*models.Revision, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		revisions = append(revisions, m.DB.revision(stored[i]))
+	}
+
+	return revisions, nil
+}
+
+// Revision fetches the revision of the snippet with snippetID that has the
+// specified version.
+func (m *SnippetModel) Revision(snippetID, version int) (*models.Revision, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	stored := m.DB.revisions[snippetID]
+	if version < 1 || version > len(stored) {
+		return nil, models.ErrNoRecord
+	}
+
+	return m.DB.revision(stored[version-1]), nil
+}
+
+// Restore publishes a new revision of the snippet with the specified id, made
+// by the user with userID, that copies the title and content of an earlier
+// version. The snippet's expiry is left as it is.
+func (m *SnippetModel) Restore(id, userID, version int) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	s, ok := m.DB.snippets[id]
+	stored := m.DB.revisions[id]
+	if !ok || version < 1 || version > len(stored) {
+		return models.ErrNoRecord
+	}
+
+	r := stored[version-1]
+	s.Title = r.Title
+	s.Content = r.Content
+	m.DB.insertRevision(id, userID, r.Title, r.Content)
+
+	return nil
+}
@@ -0,0 +1,325 @@
+package memory
+
+import (
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/mgxnch/snippetbox/internal/models"
+)
+
+// SnippetModel implements models.SnippetStore.
+type SnippetModel struct {
+	DB *DB
+}
+
+var _ models.SnippetStore = (*SnippetModel)(nil)
+
+// snippet returns a copy of the stored snippet s with its author filled in, so
+// that callers can't modify the stored data. The caller must hold db.mu.
+func (db *DB) snippet(s *models.Snippet) *models.Snippet {
+	c := *s
+	c.Author = db.authorName(c.UserID)
+	c.Tags = slices.Clone(s.Tags)
+	return &c
+}
+
+// Insert stores the snippet created by the user with userID, along with its
+// tags and its first revision.
+func (m *SnippetModel) Insert(userID int, in models.SnippetInput) (int, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	publicID, err := models.NewUniquePublicID(func(publicID string) (bool, error) {
+		for _, s := range m.DB.snippets {
+			if s.PublicID == publicID {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	slug, err := models.NewSlugFor(in.Visibility)
+	if err != nil {
+		return 0, err
+	}
+
+	created := time.Now().UTC()
+
+	m.DB.lastSnippetID++
+	s := &models.Snippet{
+		ID:               m.DB.lastSnippetID,
+		PublicID:         publicID,
+		UserID:           userID,
+		Title:            in.Title,
+		Content:          in.Content,
+		Format:           in.Format,
+		Language:         in.Language,
+		Visibility:       in.Visibility,
+		Slug:             slug.String,
+		BurnAfterReading: in.BurnAfterReading,
+		PasswordHash:     in.PasswordHash,
+		Tags:             sortedTags(in.Tags),
+		Created:          created,
+		Expires:          created.AddDate(0, 0, in.Expires),
+	}
+	m.DB.snippets[s.ID] = s
+	m.DB.insertRevision(s.ID, userID, in.Title, in.Content)
+
+	return s.ID, nil
+}
+
+// Get fetches the unexpired snippet with the specified id, if it is public or
+// was created by the user with userID.
+func (m *SnippetModel) Get(id, userID int) (*models.Snippet, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	s, ok := m.DB.snippets[id]
+	if !ok || s.Expired() || !s.VisibleTo(userID) {
+		return nil, models.ErrNoRecord
+	}
+
+	return m.DB.snippet(s), nil
+}
+
+// GetByPublicID is like Get, but fetches the snippet with the specified
+// public ID.
+func (m *SnippetModel) GetByPublicID(publicID string, userID int) (*models.Snippet, error) {
+	snippets := m.filter(func(s *models.Snippet) bool {
+		return s.PublicID == publicID && !s.Expired() && s.VisibleTo(userID)
+	})
+
+	if len(snippets) == 0 {
+		return nil, models.ErrNoRecord
+	}
+	return snippets[0], nil
+}
+
+// GetBySlug fetches the unexpired snippet with the specified slug, unless it
+// is private and wasn't created by the user with userID.
+func (m *SnippetModel) GetBySlug(slug string, userID int) (*models.Snippet, error) {
+	snippets := m.filter(func(s *models.Snippet) bool {
+		return s.Slug == slug && !s.Expired() &&
+			(s.Visibility != models.VisibilityPrivate || s.UserID == userID)
+	})
+
+	if len(snippets) == 0 {
+		return nil, models.ErrNoRecord
+	}
+	return snippets[0], nil
+}
+
+// Latest returns the 10 most recently created unexpired public snippets,
+// leaving out burn-after-reading ones.
+func (m *SnippetModel) Latest() ([]*models.Snippet, error) {
+	snippets := m.filter(listed)
+
+	if len(snippets) > 10 {
+		snippets = snippets[:10]
+	}
+	return snippets, nil
+}
+
+// List returns a page of the unexpired public snippets, leaving out
+// burn-after-reading ones, as described by opts.
+func (m *SnippetModel) List(opts models.ListOptions) (*models.SnippetList, error) {
+	cursor, ascending := opts.Keyset()
+
+	snippets := m.filter(func(s *models.Snippet) bool {
+		switch {
+		case !listed(s):
+			return false
+		case opts.Tag != "" && !slices.Contains(s.Tags, opts.Tag):
+			return false
+		case opts.Language != "" && s.Language != opts.Language:
+			return false
+		case cursor != 0 && ascending:
+			return s.ID > cursor
+		case cursor != 0:
+			return s.ID < cursor
+		}
+		return true
+	})
+
+	// filter sorts the snippets newest first
+	if ascending {
+		slices.Reverse(snippets)
+	}
+	if len(snippets) > opts.Size+1 {
+		snippets = snippets[:opts.Size+1]
+	}
+
+	return models.NewSnippetList(opts, snippets), nil
+}
+
+// ByUser returns every snippet created by the user with userID, newest first,
+// including expired ones.
+func (m *SnippetModel) ByUser(userID int) ([]*models.Snippet, error) {
+	return m.filter(func(s *models.Snippet) bool {
+		return s.UserID == userID
+	}), nil
+}
+
+// Search returns the given page of the snippets that match query, best match
+// first. Only unexpired public snippets without a password match, along with
+// every snippet created by the user with userID.
+func (m *SnippetModel) Search(query string, userID, page int) (*models.SearchResults, error) {
+	results := models.NewSearchResults(query, page)
+	if len(results.Terms) == 0 {
+		return results, nil
+	}
+
+	// Like the full-text indexes, only whole words match, and snippets which
+	// contain more of the terms rank higher
+	scores := make(map[int]int)
+	snippets := m.filter(func(s *models.Snippet) bool {
+		if s.UserID != userID && (!listed(s) || s.Protected()) {
+			return false
+		}
+
+		words := models.Words(s.Title + " " + s.Content)
+		for _, term := range results.Terms {
+			if slices.Contains(words, term) {
+				scores[s.ID]++
+			}
+		}
+		return scores[s.ID] > 0
+	})
+
+	sort.SliceStable(snippets, func(i, j int) bool {
+		return scores[snippets[i].ID] > scores[snippets[j].ID]
+	})
+
+	results.Total = len(snippets)
+	start := min((results.Page-1)*models.SearchPageSize, len(snippets))
+	end := min(start+models.SearchPageSize, len(snippets))
+	results.Snippets = snippets[start:end]
+
+	return results, nil
+}
+
+// listed returns true if s is shown to everyone in listings and searches.
+func listed(s *models.Snippet) bool {
+	return !s.Expired() && s.Visibility == models.VisibilityPublic && !s.BurnAfterReading
+}
+
+// filter returns copies of the snippets for which keep returns true, newest
+// first.
+func (m *SnippetModel) filter(keep func(*models.Snippet) bool) []*models.Snippet {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	var snippets []*models.Snippet
+	for _, s := range m.DB.snippets {
+		if keep(s) {
+			snippets = append(snippets, m.DB.snippet(s))
+		}
+	}
+
+	sort.Slice(snippets, func(i, j int) bool {
+		return snippets[i].ID > snippets[j].ID
+	})
+	return snippets
+}
+
+// Update publishes a new revision of the snippet with the specified id, made by
+// the user with userID, replaces its other fields and resets the snippet's
+// expiry. The snippet keeps its slug, if it has one, when it is made unlisted
+// again.
+func (m *SnippetModel) Update(id, userID int, in models.SnippetInput) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	s, ok := m.DB.snippets[id]
+	if !ok {
+		return models.ErrNoRecord
+	}
+
+	if s.Slug == "" {
+		slug, err := models.NewSlugFor(in.Visibility)
+		if err != nil {
+			return err
+		}
+		s.Slug = slug.String
+	}
+
+	s.Title = in.Title
+	s.Content = in.Content
+	s.Format = in.Format
+	s.Language = in.Language
+	s.Visibility = in.Visibility
+	s.BurnAfterReading = in.BurnAfterReading
+	s.PasswordHash = in.PasswordHash
+	s.Tags = sortedTags(in.Tags)
+	s.Expires = time.Now().UTC().AddDate(0, 0, in.Expires)
+	m.DB.insertRevision(id, userID, in.Title, in.Content)
+
+	return nil
+}
+
+// Burn marks the unexpired burn-after-reading snippet with the specified id as
+// burned, erases its content and revisions, and returns it as it was before
+// it was erased. Only the first call for a snippet succeeds, even when several
+// run at once. The others return models.ErrNoRecord.
+func (m *SnippetModel) Burn(id int) (*models.Snippet, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	s, ok := m.DB.snippets[id]
+	if !ok || s.Expired() || !s.BurnAfterReading || s.Burned {
+		return nil, models.ErrNoRecord
+	}
+
+	s.Burned = true
+	burned := m.DB.snippet(s)
+
+	s.Content = ""
+	delete(m.DB.revisions, id)
+
+	return burned, nil
+}
+
+// Delete removes the snippet with the specified id and its revisions. It
+// returns models.ErrNoRecord if no such snippet exists.
+func (m *SnippetModel) Delete(id int) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	if _, ok := m.DB.snippets[id]; !ok {
+		return models.ErrNoRecord
+	}
+
+	delete(m.DB.snippets, id)
+	delete(m.DB.revisions, id)
+
+	return nil
+}
+
+// PurgeExpired deletes every snippet that expired before the given time, along
+// with its revisions, and returns how many snippets were deleted. If archive
+// is true, the snippets are kept in the DB's archive first, with their tags
+// but without their revisions.
+func (m *SnippetModel) PurgeExpired(before time.Time, archive bool) (int, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	n := 0
+	for id, s := range m.DB.snippets {
+		if !s.Expires.Before(before) {
+			continue
+		}
+
+		if archive {
+			m.DB.archive = append(m.DB.archive, s)
+		}
+		delete(m.DB.snippets, id)
+		delete(m.DB.revisions, id)
+		n++
+	}
+
+	return n, nil
+}
@@ -0,0 +1,54 @@
+package memory
+
+import (
+	"slices"
+	"sort"
+
+	"github.com/mgxnch/snippetbox/internal/models"
+)
+
+// sortedTags returns a sorted copy of tags, the order in which the SQL stores
+// return them.
+func sortedTags(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	sorted := slices.Clone(tags)
+	slices.Sort(sorted)
+	return sorted
+}
+
+// TagCounts returns the n tags with the most unexpired public snippets, leaving
+// out burn-after-reading ones, along with the number of those snippets, most
+// used first.
+func (m *SnippetModel) TagCounts(n int) ([]*models.TagCount, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, s := range m.DB.snippets {
+		if !listed(s) {
+			continue
+		}
+		for _, name := range s.Tags {
+			counts[name]++
+		}
+	}
+
+	var tags []*models.TagCount
+	for name, count := range counts {
+		tags = append(tags, &models.TagCount{Name: name, Count: count})
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return tags[i].Name < tags[j].Name
+	})
+
+	if len(tags) > n {
+		tags = tags[:n]
+	}
+	return tags, nil
+}
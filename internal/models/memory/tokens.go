@@ -0,0 +1,120 @@
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/mgxnch/snippetbox/internal/models"
+)
+
+// token is a stored models.Token together with the hash of its plaintext.
+type token struct {
+	models.Token
+	hash string
+}
+
+// TokenModel implements models.TokenStore.
+type TokenModel struct {
+	DB *DB
+}
+
+var _ models.TokenStore = (*TokenModel)(nil)
+
+// Insert creates a new token for the user with userID and returns its plaintext.
+// The token expires after ttl, or never if ttl is 0.
+func (m *TokenModel) Insert(userID int, name, scope string, ttl time.Duration) (string, error) {
+	plaintext, err := models.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	m.DB.lastTokenID++
+	t := &token{
+		Token: models.Token{
+			ID:      m.DB.lastTokenID,
+			UserID:  userID,
+			Name:    name,
+			Scope:   scope,
+			Created: time.Now().UTC(),
+		},
+		hash: models.HashToken(plaintext),
+	}
+	if ttl > 0 {
+		t.Expires = t.Created.Add(ttl)
+	}
+	m.DB.tokens[t.ID] = t
+
+	return plaintext, nil
+}
+
+// Authenticate looks up the unexpired token with the given plaintext and records
+// that it has been used. It returns models.ErrInvalidCredentials if there is no
+// such token.
+func (m *TokenModel) Authenticate(plaintext string) (*models.Token, error) {
+	hash := models.HashToken(plaintext)
+
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	for _, t := range m.DB.tokens {
+		if t.hash == hash && !t.Expired() {
+			// Return the token as it was before this use, like the SQL models do
+			c := t.Token
+			t.LastUsed = time.Now().UTC()
+			return &c, nil
+		}
+	}
+
+	return nil, models.ErrInvalidCredentials
+}
+
+// ForUser returns every token of the user with userID, including expired ones.
+func (m *TokenModel) ForUser(userID int) ([]*models.Token, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	var tokens []*models.Token
+	for _, t := range m.DB.tokens {
+		if t.UserID == userID {
+			c := t.Token
+			tokens = append(tokens, &c)
+		}
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].ID > tokens[j].ID
+	})
+	return tokens, nil
+}
+
+// Revoke deletes the token with the specified id, if it belongs to the user
+// with userID. It returns models.ErrNoRecord if there is no such token.
+func (m *TokenModel) Revoke(id, userID int) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	t, ok := m.DB.tokens[id]
+	if !ok || t.UserID != userID {
+		return models.ErrNoRecord
+	}
+
+	delete(m.DB.tokens, id)
+	return nil
+}
+
+// RevokeAll deletes every token of the user with userID, e.g. after their
+// password has been reset.
+func (m *TokenModel) RevokeAll(userID int) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	for id, t := range m.DB.tokens {
+		if t.UserID == userID {
+			delete(m.DB.tokens, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package memory
+
+import (
+	"time"
+
+	"github.com/mgxnch/snippetbox/internal/models"
+)
+
+// twoFactor is a stored models.TwoFactor together with the hashes of the
+// user's unused recovery codes.
+type twoFactor struct {
+	models.TwoFactor
+	recoveryCodes map[string]bool
+}
+
+// TwoFactorModel implements models.TwoFactorStore.
+type TwoFactorModel struct {
+	DB *DB
+}
+
+var _ models.TwoFactorStore = (*TwoFactorModel)(nil)
+
+// Get fetches the two-factor settings of the user with userID. It returns
+// models.ErrNoRecord if the user hasn't turned on two-factor authentication.
+func (m *TwoFactorModel) Get(userID int) (*models.TwoFactor, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	t, ok := m.DB.twoFactor[userID]
+	if !ok {
+		return nil, models.ErrNoRecord
+	}
+
+	c := t.TwoFactor
+	c.RecoveryCodes = len(t.recoveryCodes)
+	return &c, nil
+}
+
+// Enable turns on two-factor authentication for the user with userID, with
+// the given TOTP secret and recovery codes, whose hashes are stored. Earlier
+// settings and recovery codes of the user are replaced.
+func (m *TwoFactorModel) Enable(userID int, secret string, recoveryCodes []string) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	t := &twoFactor{
+		TwoFactor: models.TwoFactor{
+			UserID:  userID,
+			Secret:  secret,
+			Created: time.Now().UTC(),
+		},
+		recoveryCodes: make(map[string]bool),
+	}
+	for _, code := range recoveryCodes {
+		t.recoveryCodes[models.HashToken(code)] = true
+	}
+	m.DB.twoFactor[userID] = t
+
+	return nil
+}
+
+// Disable turns off two-factor authentication for the user with userID, and
+// deletes their recovery codes.
+func (m *TwoFactorModel) Disable(userID int) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	delete(m.DB.twoFactor, userID)
+	return nil
+}
+
+// UseStep records that the user with userID has used the TOTP code of the
+// given time step. It returns models.ErrInvalidCredentials if a code of that
+// step or a later one has already been used, so that an intercepted code can't
+// be replayed. Only one of several concurrent calls with the same step
+// succeeds.
+func (m *TwoFactorModel) UseStep(userID int, step int64) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	t, ok := m.DB.twoFactor[userID]
+	if !ok || t.LastStep >= step {
+		return models.ErrInvalidCredentials
+	}
+	t.LastStep = step
+
+	return nil
+}
+
+// UseRecoveryCode uses up one of the recovery codes of the user with userID.
+// It returns models.ErrInvalidCredentials if the user has no such unused code.
+func (m *TwoFactorModel) UseRecoveryCode(userID int, code string) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	t, ok := m.DB.twoFactor[userID]
+	hash := models.HashToken(models.NormalizeRecoveryCode(code))
+	if !ok || !t.recoveryCodes[hash] {
+		return models.ErrInvalidCredentials
+	}
+	delete(t.recoveryCodes, hash)
+
+	return nil
+}
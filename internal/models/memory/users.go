@@ -0,0 +1,145 @@
+package memory
+
+import (
+	"time"
+
+	"github.com/mgxnch/snippetbox/internal/models"
+)
+
+// UserModel implements models.UserStore.
+type UserModel struct {
+	DB         *DB
+	BcryptCost int // 0 means models.DefaultBcryptCost
+}
+
+var _ models.UserStore = (*UserModel)(nil)
+
+// Insert stores a user. It returns models.ErrDuplicateEmail if the email is
+// already in use.
+func (m *UserModel) Insert(name, email, password string) error {
+	// Hash outside of the lock, as bcrypt is deliberately slow
+	hashedPassword, err := models.HashPassword(password, m.BcryptCost)
+	if err != nil {
+		return err
+	}
+
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	for _, u := range m.DB.users {
+		if u.Email == email {
+			return models.ErrDuplicateEmail
+		}
+	}
+
+	m.DB.lastUserID++
+	m.DB.users[m.DB.lastUserID] = &models.User{
+		ID:             m.DB.lastUserID,
+		Name:           name,
+		Email:          email,
+		HashedPassword: hashedPassword,
+		Created:        time.Now().UTC(),
+	}
+
+	return nil
+}
+
+// Authenticate verifies whether a user with the email and password exists.
+// It returns the user's ID if they do. Otherwise, this returns 0 and an error.
+func (m *UserModel) Authenticate(email, password string) (int, error) {
+	m.DB.mu.RLock()
+	var user *models.User
+	for _, u := range m.DB.users {
+		if u.Email == email {
+			user = u
+			break
+		}
+	}
+	m.DB.mu.RUnlock()
+
+	if user == nil {
+		return 0, models.ErrInvalidCredentials
+	}
+
+	err := models.CheckPassword(user.HashedPassword, password)
+	if err != nil {
+		return 0, err
+	}
+
+	return user.ID, nil
+}
+
+// Exists checks if a user with a specific ID exists.
+func (m *UserModel) Exists(id int) (bool, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	_, ok := m.DB.users[id]
+	return ok, nil
+}
+
+// Get fetches the user with the specified id.
+func (m *UserModel) Get(id int) (*models.User, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	u, ok := m.DB.users[id]
+	if !ok {
+		return nil, models.ErrNoRecord
+	}
+
+	// Like the SQL implementations, Get doesn't return the password hash
+	c := *u
+	c.HashedPassword = nil
+	return &c, nil
+}
+
+// GetByEmail fetches the user with the specified email. It returns
+// models.ErrNoRecord if there is no such user.
+func (m *UserModel) GetByEmail(email string) (*models.User, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	for _, u := range m.DB.users {
+		if u.Email == email {
+			c := *u
+			c.HashedPassword = nil
+			return &c, nil
+		}
+	}
+
+	return nil, models.ErrNoRecord
+}
+
+// UpdatePassword replaces the password of the user with the specified id. It
+// returns models.ErrNoRecord if there is no such user.
+func (m *UserModel) UpdatePassword(id int, password string) error {
+	// Hash outside of the lock, as bcrypt is deliberately slow
+	hashedPassword, err := models.HashPassword(password, m.BcryptCost)
+	if err != nil {
+		return err
+	}
+
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	u, ok := m.DB.users[id]
+	if !ok {
+		return models.ErrNoRecord
+	}
+	u.HashedPassword = hashedPassword
+
+	return nil
+}
+
+// VerifyEmail marks the email address of the user with the specified id as
+// verified.
+func (m *UserModel) VerifyEmail(id int) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	if u, ok := m.DB.users[id]; ok {
+		u.EmailVerified = true
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package models
+
+import "slices"
+
+// The orders in which SnippetStore.List can sort snippets.
+const (
+	SortNewest = "newest"
+	SortOldest = "oldest"
+)
+
+// ListOptions selects a page of snippets for SnippetStore.List. Pages are found
+// from a cursor, the ID of the last snippet on the page before or the first
+// snippet on the page after, rather than from an offset, so that they don't
+// shift as snippets are created. IDs increase with the created time, so
+// sorting by ID sorts by created time too.
+type ListOptions struct {
+	Sort     string // SortNewest or SortOldest
+	Size     int    // number of snippets on each page, must be positive
+	Tag      string // if set, only snippets with this tag are listed
+	Language string // if set, only snippets in this language are listed
+	After    int    // if set, the page starts after the snippet with this ID
+	Before   int    // if set, the page ends before the snippet with this ID
+}
+
+// Keyset returns the cursor of the page, and whether the query for it must
+// look for snippets with higher IDs, in ascending order, rather than lower IDs
+// in descending order. The query should fetch one more snippet than o.Size,
+// which NewSnippetList uses to tell if there are more pages.
+func (o ListOptions) Keyset() (cursor int, ascending bool) {
+	backwards := o.Before != 0
+	if backwards {
+		cursor = o.Before
+	} else {
+		cursor = o.After
+	}
+
+	return cursor, (o.Sort == SortOldest) != backwards
+}
+
+// SnippetList holds one page of snippets, along with the cursors of the pages
+// around it.
+type SnippetList struct {
+	Snippets []*Snippet
+	Sort     string
+	Size     int
+	Tag      string
+	Language string
+	Prev     int // cursor to use as Before for the previous page, 0 if none
+	Next     int // cursor to use as After for the next page, 0 if none
+}
+
+// NewSnippetList returns the SnippetList for the snippets that a store fetched
+// for o, as described by ListOptions.Keyset.
+func NewSnippetList(o ListOptions, snippets []*Snippet) *SnippetList {
+	list := &SnippetList{Sort: o.Sort, Size: o.Size, Tag: o.Tag, Language: o.Language}
+
+	more := len(snippets) > o.Size
+	if more {
+		snippets = snippets[:o.Size]
+	}
+	if o.Before != 0 {
+		slices.Reverse(snippets)
+	}
+	list.Snippets = snippets
+
+	if len(snippets) == 0 {
+		return list
+	}
+
+	// Coming from the next page implies that there is one, and the same goes
+	// for the previous page
+	hasPrev := o.After != 0 || (o.Before != 0 && more)
+	hasNext := o.Before != 0 || more
+
+	if hasPrev {
+		list.Prev = snippets[0].ID
+	}
+	if hasNext {
+		list.Next = snippets[len(snippets)-1].ID
+	}
+	return list
+}
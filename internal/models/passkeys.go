@@ -0,0 +1,180 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Passkey holds the data from the passkeys table: a WebAuthn credential that
+// lets a user log in with an authenticator, such as a security key or their
+// phone, instead of a password. Only the public key is stored; the private key
+// never leaves the authenticator.
+type Passkey struct {
+	ID             int
+	UserID         int
+	Name           string
+	CredentialID   []byte // chosen by the authenticator
+	PublicKey      []byte // COSE-encoded
+	SignCount      uint32 // signature counter of the last login, or 0 if the authenticator has none
+	BackupEligible bool   // whether the credential may be synced between devices, which never changes
+	Transports     string // comma-separated, e.g. "usb,nfc", as hints for the browser
+	Created        time.Time
+	LastUsed       time.Time // zero if the passkey has never been used
+}
+
+// PasskeyModel interacts with the database.
+type PasskeyModel struct {
+	DB *sql.DB
+}
+
+// Insert adds the passkey p of the user p.UserID, and returns its ID. It
+// returns ErrDuplicateCredential if a passkey with the same credential ID has
+// already been added.
+func (m *PasskeyModel) Insert(p *Passkey) (int, error) {
+	stmt := `INSERT INTO passkeys (user_id, name, credential_id, public_key, sign_count, backup_eligible, transports, created)
+	VALUES (?, ?, ?, ?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	result, err := m.DB.Exec(stmt, p.UserID, p.Name, p.CredentialID, p.PublicKey, p.SignCount, p.BackupEligible, p.Transports)
+	if err != nil {
+		var mySQLError *mysql.MySQLError
+		if errors.As(err, &mySQLError) {
+			if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "passkeys_uc_credential_id") {
+				return 0, ErrDuplicateCredential
+			}
+		}
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// ForUser returns every passkey of the user with userID, oldest first.
+func (m *PasskeyModel) ForUser(userID int) ([]*Passkey, error) {
+	stmt := `SELECT id, user_id, name, credential_id, public_key, sign_count, backup_eligible, transports, created, last_used
+	FROM passkeys WHERE user_id = ? ORDER BY id`
+
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var passkeys []*Passkey
+	for rows.Next() {
+		p, err := ScanPasskey(rows)
+		if err != nil {
+			return nil, err
+		}
+		passkeys = append(passkeys, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return passkeys, nil
+}
+
+// Use records that the passkey with id has just been used to log in, and that
+// its authenticator's signature counter is now signCount. It returns
+// ErrInvalidCredentials if the counter hasn't gone up since the last login,
+// which means that the passkey may have been cloned, unless the authenticator
+// has no counter and always reports 0. Only one of several concurrent calls
+// with the same counter succeeds.
+func (m *PasskeyModel) Use(id int, signCount uint32) error {
+	stmt := `UPDATE passkeys SET sign_count = ?, last_used = UTC_TIMESTAMP()
+	WHERE id = ? AND (sign_count < ? OR (sign_count = 0 AND ? = 0))`
+
+	result, err := m.DB.Exec(stmt, signCount, id, signCount, signCount)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+
+	// MySQL only counts the rows that have changed, and a second login within
+	// the same second with an authenticator that has no counter changes nothing
+	if signCount == 0 {
+		var exists bool
+		stmt = `SELECT EXISTS(SELECT true FROM passkeys WHERE id = ? AND sign_count = 0)`
+		if err = m.DB.QueryRow(stmt, id).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return nil
+		}
+	}
+
+	return ErrInvalidCredentials
+}
+
+// Rename changes the name of the passkey with the specified id, if it belongs
+// to the user with userID. It returns ErrNoRecord if there is no such passkey.
+func (m *PasskeyModel) Rename(id, userID int, name string) error {
+	// Without the EXISTS, MySQL reports no affected rows when the name stays
+	// the same
+	var exists bool
+	stmt := `SELECT EXISTS(SELECT true FROM passkeys WHERE id = ? AND user_id = ?)`
+	if err := m.DB.QueryRow(stmt, id, userID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNoRecord
+	}
+
+	_, err := m.DB.Exec(`UPDATE passkeys SET name = ? WHERE id = ? AND user_id = ?`, name, id, userID)
+	return err
+}
+
+// Revoke deletes the passkey with the specified id, if it belongs to the user
+// with userID. It returns ErrNoRecord if there is no such passkey.
+func (m *PasskeyModel) Revoke(id, userID int) error {
+	stmt := `DELETE FROM passkeys WHERE id = ? AND user_id = ?`
+
+	result, err := m.DB.Exec(stmt, id, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// ScanPasskey scans a row with the columns id, user_id, name, credential_id,
+// public_key, sign_count, backup_eligible, transports, created and last_used
+// into a Passkey.
+func ScanPasskey(row Scanner) (*Passkey, error) {
+	var p Passkey
+	var lastUsed sql.NullTime
+
+	err := row.Scan(&p.ID, &p.UserID, &p.Name, &p.CredentialID, &p.PublicKey, &p.SignCount,
+		&p.BackupEligible, &p.Transports, &p.Created, &lastUsed)
+	if err != nil {
+		return nil, err
+	}
+	p.LastUsed = lastUsed.Time
+
+	return &p, nil
+}
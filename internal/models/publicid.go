@@ -0,0 +1,63 @@
+package models
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+)
+
+// ErrPublicIDCollision is returned when no unused public ID could be found for
+// a new snippet.
+var ErrPublicIDCollision = errors.New("models: could not generate a unique public ID")
+
+// base62 is the alphabet of public IDs.
+const base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// publicIDLength is the length of new public IDs, which gives them about 59
+// random bits.
+const publicIDLength = 10
+
+// maxPublicIDAttempts is how many public IDs NewUniquePublicID tries before it
+// gives up. With 59 random bits, even one collision is very unlikely.
+const maxPublicIDAttempts = 5
+
+// NewPublicID returns a new random base62 ID for a snippet, which is used in
+// URLs instead of its auto-increment ID, so that snippets can't be found by
+// counting up. Public IDs start with a letter, so they are never mistaken for
+// the integer IDs in legacy URLs.
+func NewPublicID() (string, error) {
+	b := make([]byte, publicIDLength)
+	for i := range b {
+		alphabet := base62
+		if i == 0 {
+			alphabet = base62[10:]
+		}
+
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		if err != nil {
+			return "", err
+		}
+		b[i] = alphabet[n.Int64()]
+	}
+	return string(b), nil
+}
+
+// NewUniquePublicID returns a new public ID for which exists returns false. It
+// returns ErrPublicIDCollision if it can't find one.
+func NewUniquePublicID(exists func(publicID string) (bool, error)) (string, error) {
+	for range maxPublicIDAttempts {
+		publicID, err := NewPublicID()
+		if err != nil {
+			return "", err
+		}
+
+		taken, err := exists(publicID)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return publicID, nil
+		}
+	}
+	return "", ErrPublicIDCollision
+}
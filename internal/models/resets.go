@@ -0,0 +1,125 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"time"
+)
+
+// PasswordReset holds the data from the password_resets table. Like API
+// tokens, only the SHA-256 hash of a reset token is stored, see HashToken.
+type PasswordReset struct {
+	ID      int
+	UserID  int
+	Created time.Time
+	Expires time.Time
+}
+
+// GenerateResetToken returns the plaintext of a new random password reset
+// token. Unlike API tokens, it has no prefix, as it only ever appears in
+// links.
+func GenerateResetToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// PasswordResetModel interacts with the database.
+type PasswordResetModel struct {
+	DB *sql.DB
+}
+
+// Insert creates a reset token for the user with userID, which expires after
+// ttl, and returns its plaintext. The user's earlier tokens are deleted, so
+// that only the newest link works.
+func (m *PasswordResetModel) Insert(userID int, ttl time.Duration) (string, error) {
+	plaintext, err := GenerateResetToken()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM password_resets WHERE user_id = ?`, userID)
+	if err != nil {
+		return "", err
+	}
+
+	stmt := `INSERT INTO password_resets (user_id, hash, created, expires)
+	VALUES (?, ?, UTC_TIMESTAMP(), ?)`
+
+	_, err = tx.Exec(stmt, userID, HashToken(plaintext), time.Now().UTC().Add(ttl))
+	if err != nil {
+		return "", err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", err
+	}
+
+	return plaintext, nil
+}
+
+// Get looks up the unexpired reset token with the given plaintext. It returns
+// ErrInvalidCredentials if there is no such token.
+func (m *PasswordResetModel) Get(plaintext string) (*PasswordReset, error) {
+	var r PasswordReset
+
+	stmt := `SELECT id, user_id, created, expires FROM password_resets
+	WHERE hash = ? AND expires > UTC_TIMESTAMP()`
+
+	err := m.DB.QueryRow(stmt, HashToken(plaintext)).Scan(&r.ID, &r.UserID, &r.Created, &r.Expires)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// Redeem uses up the unexpired reset token with the given plaintext, and
+// returns the ID of its user. It returns ErrInvalidCredentials if there is no
+// such token. Only one of several concurrent calls with the same token
+// succeeds.
+func (m *PasswordResetModel) Redeem(plaintext string) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// FOR UPDATE makes concurrent calls wait for this one, after which they
+	// find the token gone
+	var userID int
+	stmt := `SELECT user_id FROM password_resets
+	WHERE hash = ? AND expires > UTC_TIMESTAMP() FOR UPDATE`
+
+	err = tx.QueryRow(stmt, HashToken(plaintext)).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInvalidCredentials
+		}
+		return 0, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM password_resets WHERE user_id = ?`, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
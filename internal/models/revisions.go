@@ -0,0 +1,116 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Revision holds the data from the snippet_revisions table. Revisions are
+// never changed once they have been inserted.
+type Revision struct {
+	ID        int
+	SnippetID int
+	Version   int    // 1 for the first revision of a snippet, counting up
+	UserID    int    // ID of the user who published the revision
+	Author    string // name of the user who published the revision
+	Title     string
+	Content   string
+	Created   time.Time
+}
+
+// insertRevision adds the next revision of the snippet with snippetID as part
+// of tx. Locking the snippet's existing revisions makes concurrent publishes
+// wait for each other, so that every version number is only used once.
+func insertRevision(tx *sql.Tx, snippetID, userID int, title, content string) error {
+	var version int
+
+	stmt := `SELECT COALESCE(MAX(version), 0) + 1 FROM snippet_revisions
+	WHERE snippet_id = ? FOR UPDATE`
+	err := tx.QueryRow(stmt, snippetID).Scan(&version)
+	if err != nil {
+		return err
+	}
+
+	stmt = `INSERT INTO snippet_revisions (snippet_id, version, user_id, title, content, created)
+	VALUES (?, ?, ?, ?, ?, UTC_TIMESTAMP())`
+	_, err = tx.Exec(stmt, snippetID, version, userID, title, content)
+	return err
+}
+
+// Revisions returns every revision of the snippet with snippetID, newest first.
+func (m *SnippetModel) Revisions(snippetID int) ([]*Revision, error) {
+	stmt := `SELECT r.id, r.snippet_id, r.version, COALESCE(r.user_id, 0), COALESCE(u.name, ''), r.title, r.content, r.created
+	FROM snippet_revisions r LEFT JOIN users u ON u.id = r.user_id
+	WHERE r.snippet_id = ? ORDER BY r.version DESC`
+
+	rows, err := m.DB.Query(stmt, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []*Revision
+	for rows.Next() {
+		var r Revision
+		err := rows.Scan(&r.ID, &r.SnippetID, &r.Version, &r.UserID, &r.Author, &r.Title, &r.Content, &r.Created)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, &r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// Revision fetches the revision of the snippet with snippetID that has the
+// specified version.
+func (m *SnippetModel) Revision(snippetID, version int) (*Revision, error) {
+	stmt := `SELECT r.id, r.snippet_id, r.version, COALESCE(r.user_id, 0), COALESCE(u.name, ''), r.title, r.content, r.created
+	FROM snippet_revisions r LEFT JOIN users u ON u.id = r.user_id
+	WHERE r.snippet_id = ? AND r.version = ?`
+
+	var r Revision
+	err := m.DB.QueryRow(stmt, snippetID, version).Scan(&r.ID, &r.SnippetID, &r.Version, &r.UserID, &r.Author, &r.Title, &r.Content, &r.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// Restore publishes a new revision of the snippet with the specified id, made
+// by the user with userID, that copies the title and content of an earlier
+// version. The snippet's expiry is left as it is.
+func (m *SnippetModel) Restore(id, userID, version int) error {
+	r, err := m.Revision(id, version)
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `UPDATE snippets SET title = ?, content = ? WHERE id = ?`
+	_, err = tx.Exec(stmt, r.Title, r.Content, id)
+	if err != nil {
+		return err
+	}
+
+	err = insertRevision(tx, id, userID, r.Title, r.Content)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// SearchPageSize is the number of snippets on each page of search results.
+const SearchPageSize = 10
+
+// maxSearchTerms is the number of words of a query that are searched for. The
+// rest are ignored.
+const maxSearchTerms = 10
+
+// SearchResults holds one page of the snippets that match a search query, best
+// match first.
+type SearchResults struct {
+	Query    string
+	Terms    []string // the words searched for, see SearchTerms
+	Snippets []*Snippet
+	Page     int // starting from 1
+	Total    int // number of matching snippets on every page
+}
+
+// LastPage returns the number of the last page of results, or 0 if nothing
+// matched.
+func (r *SearchResults) LastPage() int {
+	return (r.Total + SearchPageSize - 1) / SearchPageSize
+}
+
+// PrevPage returns the number of the previous page, or 0 if this is the first.
+func (r *SearchResults) PrevPage() int {
+	if r.Page <= 1 {
+		return 0
+	}
+	return min(r.Page-1, r.LastPage())
+}
+
+// NextPage returns the number of the next page, or 0 if this is the last.
+func (r *SearchResults) NextPage() int {
+	if r.Page >= r.LastPage() {
+		return 0
+	}
+	return r.Page + 1
+}
+
+// NewSearchResults returns the SearchResults of query with no snippets yet.
+// Every SnippetStore starts its Search with it.
+func NewSearchResults(query string, page int) *SearchResults {
+	return &SearchResults{
+		Query: query,
+		Terms: SearchTerms(query),
+		Page:  max(page, 1),
+	}
+}
+
+// SearchTerms splits a search query into the words that are searched for,
+// without duplicates. Any punctuation is ignored, so queries can't use search
+// operators.
+func SearchTerms(query string) []string {
+	var terms []string
+	for _, w := range Words(query) {
+		if !slices.Contains(terms, w) {
+			terms = append(terms, w)
+		}
+		if len(terms) == maxSearchTerms {
+			break
+		}
+	}
+	return terms
+}
+
+// Words splits text into lowercase words the same way that the full-text
+// indexes do, i.e. at every character that isn't a letter or a digit.
+func Words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
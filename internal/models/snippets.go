@@ -3,16 +3,60 @@ package models
 import (
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
 )
 
+// The formats of a snippet's content, which decide how it is displayed.
+const (
+	FormatPlain    = "plain"    // shown as it is
+	FormatCode     = "code"     // highlighted as the snippet's Language
+	FormatMarkdown = "markdown" // rendered as HTML
+)
+
 // Snippet holds the data from the snippets table.
 type Snippet struct {
-	ID      int
-	Title   string
-	Content string
-	Created time.Time
-	Expires time.Time
+	ID               int
+	PublicID         string // random base62 ID of the snippet in URLs, see NewPublicID
+	Legacy           bool   // created before public IDs, so its integer URLs redirect
+	UserID           int    // ID of the user who created the snippet, 0 if unknown
+	Author           string // name of the user who created the snippet
+	Title            string
+	Content          string
+	Format           string   // one of FormatPlain, FormatCode or FormatMarkdown
+	Language         string   // name of the language it is highlighted as, "" for plain text
+	Visibility       string   // one of VisibilityPublic, VisibilityUnlisted or VisibilityPrivate
+	Slug             string   // random ID of the snippet in URLs while it is unlisted, "" if it never was
+	BurnAfterReading bool     // deleted when it is first viewed, see SnippetModel.Burn
+	Burned           bool     // viewed by someone, so its content is gone
+	PasswordHash     []byte   // bcrypt hash of the password needed to view it, nil if it has none
+	Tags             []string // names of the snippet's tags, in alphabetical order
+	Created          time.Time
+	Expires          time.Time
+}
+
+// SnippetInput holds the fields of a snippet that its author sets when they
+// create or edit it.
+type SnippetInput struct {
+	Title            string
+	Content          string
+	Format           string
+	Language         string
+	Visibility       string
+	BurnAfterReading bool
+	PasswordHash     []byte // see HashPassword; nil for no password
+	Tags             []string
+	Expires          int // days from now
+}
+
+// Expired returns true if the snippet is past its expiry time.
+func (s *Snippet) Expired() bool {
+	return !s.Expires.After(time.Now())
+}
+
+// Protected returns true if a password is needed to view the snippet.
+func (s *Snippet) Protected() bool {
+	return s.PasswordHash != nil
 }
 
 // SnippetModel interacts with the database.
@@ -20,12 +64,32 @@ type SnippetModel struct {
 	DB *sql.DB
 }
 
-// Insert inserts the snippet into the database.
-func (m *SnippetModel) Insert(title, content string, expires int) (int, error) {
-	stmt := `INSERT INTO snippets (title, content, created, expires)
-	VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`
+// Insert inserts the snippet created by the user with userID into the database,
+// along with its tags and its first revision.
+func (m *SnippetModel) Insert(userID int, in SnippetInput) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	// Rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	publicID, err := NewUniquePublicID(func(publicID string) (bool, error) {
+		return publicIDExists(tx, publicID)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	slug, err := NewSlugFor(in.Visibility)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := `INSERT INTO snippets (public_id, user_id, title, content, format, language, visibility, slug, burn_after_reading, password_hash, created, expires)
+	VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`
 
-	result, err := m.DB.Exec(stmt, title, content, expires)
+	result, err := tx.Exec(stmt, publicID, userID, in.Title, in.Content, in.Format, in.Language, in.Visibility, slug, in.BurnAfterReading, string(in.PasswordHash), in.Expires)
 	if err != nil {
 		return 0, err
 	}
@@ -35,18 +99,72 @@ func (m *SnippetModel) Insert(title, content string, expires int) (int, error) {
 		return 0, err
 	}
 
+	err = setTags(tx, int(id), in.Tags)
+	if err != nil {
+		return 0, err
+	}
+
+	err = insertRevision(tx, int(id), userID, in.Title, in.Content)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
 	return int(id), nil
 }
 
-// Get fetches the snippet with the specified id.
-func (m *SnippetModel) Get(id int) (*Snippet, error) {
-	stmt := `SELECT id, title, content, created, expires from snippets where 
-	expires > UTC_TIMESTAMP() and id = ?`
+// publicIDExists returns true if a snippet already has the public ID.
+func publicIDExists(tx *sql.Tx, publicID string) (bool, error) {
+	var exists bool
+	err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM snippets WHERE public_id = ?)`, publicID).Scan(&exists)
+	return exists, err
+}
+
+// Get fetches the unexpired snippet with the specified id, if it is public or
+// was created by the user with userID.
+func (m *SnippetModel) Get(id, userID int) (*Snippet, error) {
+	stmt := `SELECT s.id, s.public_id, s.legacy, COALESCE(s.user_id, 0), COALESCE(u.name, ''), s.title, s.content, s.format, s.language, s.visibility, COALESCE(s.slug, ''), s.burn_after_reading, s.burned, s.password_hash, s.created, s.expires,
+	` + tagsColumn + `
+	FROM snippets s LEFT JOIN users u ON u.id = s.user_id
+	WHERE s.expires > UTC_TIMESTAMP() AND s.id = ? AND (s.visibility = 'public' OR s.user_id = ?)`
+
+	return m.get(stmt, id, userID)
+}
+
+// GetByPublicID is like Get, but fetches the snippet with the specified
+// public ID.
+func (m *SnippetModel) GetByPublicID(publicID string, userID int) (*Snippet, error) {
+	stmt := `SELECT s.id, s.public_id, s.legacy, COALESCE(s.user_id, 0), COALESCE(u.name, ''), s.title, s.content, s.format, s.language, s.visibility, COALESCE(s.slug, ''), s.burn_after_reading, s.burned, s.password_hash, s.created, s.expires,
+	` + tagsColumn + `
+	FROM snippets s LEFT JOIN users u ON u.id = s.user_id
+	WHERE s.expires > UTC_TIMESTAMP() AND s.public_id = ? AND (s.visibility = 'public' OR s.user_id = ?)`
+
+	return m.get(stmt, publicID, userID)
+}
 
-	row := m.DB.QueryRow(stmt, id)
+// GetBySlug fetches the unexpired snippet with the specified slug, unless it
+// is private and wasn't created by the user with userID.
+func (m *SnippetModel) GetBySlug(slug string, userID int) (*Snippet, error) {
+	stmt := `SELECT s.id, s.public_id, s.legacy, COALESCE(s.user_id, 0), COALESCE(u.name, ''), s.title, s.content, s.format, s.language, s.visibility, COALESCE(s.slug, ''), s.burn_after_reading, s.burned, s.password_hash, s.created, s.expires,
+	` + tagsColumn + `
+	FROM snippets s LEFT JOIN users u ON u.id = s.user_id
+	WHERE s.expires > UTC_TIMESTAMP() AND s.slug = ? AND (s.visibility <> 'private' OR s.user_id = ?)`
+
+	return m.get(stmt, slug, userID)
+}
 
+// get runs stmt with args and scans the row it returns into a Snippet.
+func (m *SnippetModel) get(stmt string, args ...any) (*Snippet, error) {
+	return scanSnippet(m.DB.QueryRow(stmt, args...))
+}
+
+// scanSnippet scans row into a Snippet.
+func scanSnippet(row *sql.Row) (*Snippet, error) {
 	var snippet Snippet
-	err := row.Scan(&snippet.ID, &snippet.Title, &snippet.Content, &snippet.Created, &snippet.Expires)
+	err := row.Scan(&snippet.ID, &snippet.PublicID, &snippet.Legacy, &snippet.UserID, &snippet.Author, &snippet.Title, &snippet.Content, &snippet.Format, &snippet.Language, &snippet.Visibility, &snippet.Slug, &snippet.BurnAfterReading, &snippet.Burned, &snippet.PasswordHash, &snippet.Created, &snippet.Expires, (*TagList)(&snippet.Tags))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNoRecord
@@ -58,12 +176,111 @@ func (m *SnippetModel) Get(id int) (*Snippet, error) {
 	return &snippet, nil
 }
 
-// Latest returns the 10 most recently snippets.
+// Latest returns the 10 most recently created public snippets, leaving out
+// burn-after-reading ones.
 func (m *SnippetModel) Latest() ([]*Snippet, error) {
-	stmt := `SELECT id, title, content, created, expires from snippets 
-	WHERE expires > UTC_TIMESTAMP() ORDER BY id DESC LIMIT 10`
+	stmt := `SELECT s.id, s.public_id, s.legacy, COALESCE(s.user_id, 0), COALESCE(u.name, ''), s.title, s.content, s.format, s.language, s.visibility, COALESCE(s.slug, ''), s.burn_after_reading, s.burned, s.password_hash, s.created, s.expires,
+	` + tagsColumn + `
+	FROM snippets s LEFT JOIN users u ON u.id = s.user_id
+	WHERE s.expires > UTC_TIMESTAMP() AND s.visibility = 'public' AND NOT s.burn_after_reading
+	ORDER BY s.id DESC LIMIT 10`
+
+	return m.query(stmt)
+}
+
+// List returns a page of the unexpired public snippets, leaving out
+// burn-after-reading ones, as described by opts.
+func (m *SnippetModel) List(opts ListOptions) (*SnippetList, error) {
+	stmt := `SELECT s.id, s.public_id, s.legacy, COALESCE(s.user_id, 0), COALESCE(u.name, ''), s.title, s.content, s.format, s.language, s.visibility, COALESCE(s.slug, ''), s.burn_after_reading, s.burned, s.password_hash, s.created, s.expires,
+	` + tagsColumn + `
+	FROM snippets s LEFT JOIN users u ON u.id = s.user_id
+	WHERE s.expires > UTC_TIMESTAMP() AND s.visibility = 'public' AND NOT s.burn_after_reading`
+	var args []any
+
+	if opts.Tag != "" {
+		stmt += ` AND EXISTS (SELECT 1 FROM snippet_tags st JOIN tags t ON t.id = st.tag_id
+		WHERE st.snippet_id = s.id AND t.name = ?)`
+		args = append(args, opts.Tag)
+	}
+
+	if opts.Language != "" {
+		stmt += ` AND s.language = ?`
+		args = append(args, opts.Language)
+	}
+
+	cursor, ascending := opts.Keyset()
+	if cursor != 0 && ascending {
+		stmt += ` AND s.id > ?`
+		args = append(args, cursor)
+	} else if cursor != 0 {
+		stmt += ` AND s.id < ?`
+		args = append(args, cursor)
+	}
+
+	if ascending {
+		stmt += ` ORDER BY s.id ASC LIMIT ?`
+	} else {
+		stmt += ` ORDER BY s.id DESC LIMIT ?`
+	}
+	args = append(args, opts.Size+1)
 
-	rows, err := m.DB.Query(stmt)
+	snippets, err := m.query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSnippetList(opts, snippets), nil
+}
+
+// ByUser returns every snippet created by the user with userID, newest first.
+// Unlike Latest, expired snippets are included.
+func (m *SnippetModel) ByUser(userID int) ([]*Snippet, error) {
+	stmt := `SELECT s.id, s.public_id, s.legacy, COALESCE(s.user_id, 0), COALESCE(u.name, ''), s.title, s.content, s.format, s.language, s.visibility, COALESCE(s.slug, ''), s.burn_after_reading, s.burned, s.password_hash, s.created, s.expires,
+	` + tagsColumn + `
+	FROM snippets s LEFT JOIN users u ON u.id = s.user_id
+	WHERE s.user_id = ? ORDER BY s.id DESC`
+
+	return m.query(stmt, userID)
+}
+
+// Search returns the given page of the snippets that match query, best match
+// first. Only unexpired public snippets without a password match, along with
+// every snippet created by the user with userID.
+func (m *SnippetModel) Search(query string, userID, page int) (*SearchResults, error) {
+	results := NewSearchResults(query, page)
+	if len(results.Terms) == 0 {
+		return results, nil
+	}
+
+	// Search for the terms rather than the query itself, so that the results
+	// match those of the other stores, which don't support MySQL's operators
+	against := strings.Join(results.Terms, " ")
+	where := `MATCH(s.title, s.content) AGAINST(? IN NATURAL LANGUAGE MODE)
+	AND (s.user_id = ? OR (s.expires > UTC_TIMESTAMP() AND s.visibility = 'public' AND NOT s.burn_after_reading AND s.password_hash IS NULL))`
+
+	err := m.DB.QueryRow(`SELECT COUNT(*) FROM snippets s WHERE `+where, against, userID).Scan(&results.Total)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := `SELECT s.id, s.public_id, s.legacy, COALESCE(s.user_id, 0), COALESCE(u.name, ''), s.title, s.content, s.format, s.language, s.visibility, COALESCE(s.slug, ''), s.burn_after_reading, s.burned, s.password_hash, s.created, s.expires,
+	` + tagsColumn + `
+	FROM snippets s LEFT JOIN users u ON u.id = s.user_id
+	WHERE ` + where + `
+	ORDER BY MATCH(s.title, s.content) AGAINST(? IN NATURAL LANGUAGE MODE) DESC, s.id DESC
+	LIMIT ? OFFSET ?`
+
+	results.Snippets, err = m.query(stmt, against, userID, against, SearchPageSize, (results.Page-1)*SearchPageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// query runs stmt with args and scans every row of the resultset into a Snippet.
+func (m *SnippetModel) query(stmt string, args ...any) ([]*Snippet, error) {
+	rows, err := m.DB.Query(stmt, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -75,7 +292,7 @@ func (m *SnippetModel) Latest() ([]*Snippet, error) {
 	var snippets []*Snippet
 	for rows.Next() {
 		var snippet Snippet
-		err := rows.Scan(&snippet.ID, &snippet.Title, &snippet.Content, &snippet.Created, &snippet.Expires)
+		err := rows.Scan(&snippet.ID, &snippet.PublicID, &snippet.Legacy, &snippet.UserID, &snippet.Author, &snippet.Title, &snippet.Content, &snippet.Format, &snippet.Language, &snippet.Visibility, &snippet.Slug, &snippet.BurnAfterReading, &snippet.Burned, &snippet.PasswordHash, &snippet.Created, &snippet.Expires, (*TagList)(&snippet.Tags))
 		if err != nil {
 			return nil, err
 		}
@@ -90,3 +307,156 @@ func (m *SnippetModel) Latest() ([]*Snippet, error) {
 
 	return snippets, nil
 }
+
+// Update publishes a new revision of the snippet with the specified id, made by
+// the user with userID, replaces its other fields and resets the snippet's
+// expiry. The snippet keeps its slug, if it has one, when it is made unlisted
+// again.
+func (m *SnippetModel) Update(id, userID int, in SnippetInput) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	slug, err := NewSlugFor(in.Visibility)
+	if err != nil {
+		return err
+	}
+
+	stmt := `UPDATE snippets SET title = ?, content = ?, format = ?, language = ?, visibility = ?,
+	slug = COALESCE(slug, ?), burn_after_reading = ?, password_hash = NULLIF(?, ''), expires = DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY) WHERE id = ?`
+
+	_, err = tx.Exec(stmt, in.Title, in.Content, in.Format, in.Language, in.Visibility, slug, in.BurnAfterReading, string(in.PasswordHash), in.Expires, id)
+	if err != nil {
+		return err
+	}
+
+	err = setTags(tx, id, in.Tags)
+	if err != nil {
+		return err
+	}
+
+	err = insertRevision(tx, id, userID, in.Title, in.Content)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Burn marks the unexpired burn-after-reading snippet with the specified id as
+// burned, erases its content and revisions, and returns it as it was before
+// it was erased. Only the first call for a snippet succeeds, even when several
+// run at once. The others return ErrNoRecord.
+func (m *SnippetModel) Burn(id int) (*Snippet, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// The UPDATE locks the row until the transaction ends, so concurrent calls
+	// wait for this one and then find the snippet already burned
+	stmt := `UPDATE snippets SET burned = TRUE
+	WHERE id = ? AND burn_after_reading AND NOT burned AND expires > UTC_TIMESTAMP()`
+
+	result, err := tx.Exec(stmt, id)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, ErrNoRecord
+	}
+
+	stmt = `SELECT s.id, s.public_id, s.legacy, COALESCE(s.user_id, 0), COALESCE(u.name, ''), s.title, s.content, s.format, s.language, s.visibility, COALESCE(s.slug, ''), s.burn_after_reading, s.burned, s.password_hash, s.created, s.expires,
+	` + tagsColumn + `
+	FROM snippets s LEFT JOIN users u ON u.id = s.user_id
+	WHERE s.id = ?`
+
+	snippet, err := scanSnippet(tx.QueryRow(stmt, id))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`UPDATE snippets SET content = '' WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM snippet_revisions WHERE snippet_id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return snippet, nil
+}
+
+// Delete removes the snippet with the specified id. It returns ErrNoRecord
+// if no such snippet exists.
+func (m *SnippetModel) Delete(id int) error {
+	stmt := `DELETE FROM snippets WHERE id = ?`
+
+	result, err := m.DB.Exec(stmt, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// PurgeExpired deletes every snippet that expired before the given time, along
+// with its revisions, and returns how many snippets were deleted. If archive
+// is true, the snippets are copied to the snippets_archive table first, with
+// their tags but without their revisions.
+func (m *SnippetModel) PurgeExpired(before time.Time, archive bool) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if archive {
+		stmt := `INSERT INTO snippets_archive (id, public_id, user_id, title, content, format, language, visibility, slug, password_hash, tags, created, expires, archived)
+		SELECT s.id, s.public_id, s.user_id, s.title, s.content, s.format, s.language, s.visibility, s.slug, s.password_hash, ` + tagsColumn + `, s.created, s.expires, UTC_TIMESTAMP() FROM snippets s
+		WHERE s.expires < ?`
+
+		_, err = tx.Exec(stmt, before.UTC())
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	result, err := tx.Exec(`DELETE FROM snippets WHERE expires < ?`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
@@ -0,0 +1,133 @@
+package sqlite
+
+import (
+	"database/sql"
+
+	"github.com/mgxnch/snippetbox/internal/models"
+)
+
+// PasskeyModel implements models.PasskeyStore.
+type PasskeyModel struct {
+	DB *sql.DB
+}
+
+var _ models.PasskeyStore = (*PasskeyModel)(nil)
+
+// Insert adds the passkey p of the user p.UserID, and returns its ID. It
+// returns models.ErrDuplicateCredential if a passkey with the same credential
+// ID has already been added.
+func (m *PasskeyModel) Insert(p *models.Passkey) (int, error) {
+	stmt := `INSERT INTO passkeys (user_id, name, credential_id, public_key, sign_count, backup_eligible, transports, created)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+
+	result, err := m.DB.Exec(stmt, p.UserID, p.Name, p.CredentialID, p.PublicKey, p.SignCount, p.BackupEligible, p.Transports, now())
+	if err != nil {
+		if isUniqueViolation(err, "passkeys.credential_id") {
+			return 0, models.ErrDuplicateCredential
+		}
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// ForUser returns every passkey of the user with userID, oldest first.
+func (m *PasskeyModel) ForUser(userID int) ([]*models.Passkey, error) {
+	stmt := `SELECT id, user_id, name, credential_id, public_key, sign_count, backup_eligible, transports, created, last_used
+	FROM passkeys WHERE user_id = ? ORDER BY id`
+
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var passkeys []*models.Passkey
+	for rows.Next() {
+		p, err := models.ScanPasskey(rows)
+		if err != nil {
+			return nil, err
+		}
+		passkeys = append(passkeys, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return passkeys, nil
+}
+
+// Use records that the passkey with id has just been used to log in, and that
+// its authenticator's signature counter is now signCount. It returns
+// models.ErrInvalidCredentials if the counter hasn't gone up since the last
+// login, which means that the passkey may have been cloned, unless the
+// authenticator has no counter and always reports 0. Only one of several
+// concurrent calls with the same counter succeeds.
+func (m *PasskeyModel) Use(id int, signCount uint32) error {
+	stmt := `UPDATE passkeys SET sign_count = ?, last_used = ?
+	WHERE id = ? AND (sign_count < ? OR (sign_count = 0 AND ? = 0))`
+
+	result, err := m.DB.Exec(stmt, signCount, now(), id, signCount, signCount)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrInvalidCredentials
+	}
+
+	return nil
+}
+
+// Rename changes the name of the passkey with the specified id, if it belongs
+// to the user with userID. It returns models.ErrNoRecord if there is no such
+// passkey.
+func (m *PasskeyModel) Rename(id, userID int, name string) error {
+	stmt := `UPDATE passkeys SET name = ? WHERE id = ? AND user_id = ?`
+
+	result, err := m.DB.Exec(stmt, name, id, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
+
+// Revoke deletes the passkey with the specified id, if it belongs to the user
+// with userID. It returns models.ErrNoRecord if there is no such passkey.
+func (m *PasskeyModel) Revoke(id, userID int) error {
+	stmt := `DELETE FROM passkeys WHERE id = ? AND user_id = ?`
+
+	result, err := m.DB.Exec(stmt, id, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
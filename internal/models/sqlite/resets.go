@@ -0,0 +1,107 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/mgxnch/snippetbox/internal/models"
+)
+
+// PasswordResetModel implements models.PasswordResetStore.
+type PasswordResetModel struct {
+	DB *sql.DB
+}
+
+var _ models.PasswordResetStore = (*PasswordResetModel)(nil)
+
+// Insert creates a reset token for the user with userID, which expires after
+// ttl, and returns its plaintext. The user's earlier tokens are deleted, so
+// that only the newest link works.
+func (m *PasswordResetModel) Insert(userID int, ttl time.Duration) (string, error) {
+	plaintext, err := models.GenerateResetToken()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM password_resets WHERE user_id = ?`, userID)
+	if err != nil {
+		return "", err
+	}
+
+	created := now()
+	stmt := `INSERT INTO password_resets (user_id, hash, created, expires)
+	VALUES (?, ?, ?, ?)`
+
+	_, err = tx.Exec(stmt, userID, models.HashToken(plaintext), created, created.Add(ttl))
+	if err != nil {
+		return "", err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", err
+	}
+
+	return plaintext, nil
+}
+
+// Get looks up the unexpired reset token with the given plaintext. It returns
+// models.ErrInvalidCredentials if there is no such token.
+func (m *PasswordResetModel) Get(plaintext string) (*models.PasswordReset, error) {
+	var r models.PasswordReset
+
+	stmt := `SELECT id, user_id, created, expires FROM password_resets
+	WHERE hash = ? AND expires > ?`
+
+	err := m.DB.QueryRow(stmt, models.HashToken(plaintext), now()).Scan(&r.ID, &r.UserID, &r.Created, &r.Expires)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// Redeem uses up the unexpired reset token with the given plaintext, and
+// returns the ID of its user. It returns models.ErrInvalidCredentials if there
+// is no such token. Only one of several concurrent calls with the same token
+// succeeds.
+func (m *PasswordResetModel) Redeem(plaintext string) (int, error) {
+	// Transactions take the write lock as soon as they begin, so concurrent
+	// calls wait for this one, after which they find the token gone
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	stmt := `SELECT user_id FROM password_resets WHERE hash = ? AND expires > ?`
+
+	err = tx.QueryRow(stmt, models.HashToken(plaintext), now()).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, models.ErrInvalidCredentials
+		}
+		return 0, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM password_resets WHERE user_id = ?`, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
@@ -0,0 +1,114 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/mgxnch/snippetbox/internal/models"
+)
+
+// revisionColumns are the columns scanned by scanRevision. Queries using them
+// must alias snippet_revisions as r and join users as u.
+const revisionColumns = `r.id, r.snippet_id, r.version, COALESCE(r.user_id, 0), COALESCE(u.name, ''), r.title, r.content, r.created`
+
+// scanRevision scans a row with the revisionColumns into a Revision.
+func scanRevision(row models.Scanner) (*models.Revision, error) {
+	var r models.Revision
+	err := row.Scan(&r.ID, &r.SnippetID, &r.Version, &r.UserID, &r.Author, &r.Title, &r.Content, &r.Created)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// insertRevision adds the next revision of the snippet with snippetID as part
+// of tx. Transactions hold the database's write lock from the start, so
+// concurrent publishes can't pick the same version number.
+func insertRevision(tx *sql.Tx, snippetID, userID int, title, content string) error {
+	var version int
+
+	stmt := `SELECT COALESCE(MAX(version), 0) + 1 FROM snippet_revisions WHERE snippet_id = ?`
+	err := tx.QueryRow(stmt, snippetID).Scan(&version)
+	if err != nil {
+		return err
+	}
+
+	stmt = `INSERT INTO snippet_revisions (snippet_id, version, user_id, title, content, created)
+	VALUES (?, ?, ?, ?, ?, ?)`
+	_, err = tx.Exec(stmt, snippetID, version, userID, title, content, now())
+	return err
+}
+
+// Revisions returns every revision of the snippet with snippetID, newest first.
+func (m *SnippetModel) Revisions(snippetID int) ([]*models.Revision, error) {
+	stmt := `SELECT ` + revisionColumns + `
+	FROM snippet_revisions r LEFT JOIN users u ON u.id = r.user_id
+	WHERE r.snippet_id = ? ORDER BY r.version DESC`
+
+	rows, err := m.DB.Query(stmt, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []*models.Revision
+	for rows.Next() {
+		r, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// Revision fetches the revision of the snippet with snippetID that has the
+// specified version.
+func (m *SnippetModel) Revision(snippetID, version int) (*models.Revision, error) {
+	stmt := `SELECT ` + revisionColumns + `
+	FROM snippet_revisions r LEFT JOIN users u ON u.id = r.user_id
+	WHERE r.snippet_id = ? AND r.version = ?`
+
+	r, err := scanRevision(m.DB.QueryRow(stmt, snippetID, version))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Restore publishes a new revision of the snippet with the specified id, made
+// by the user with userID, that copies the title and content of an earlier
+// version. The snippet's expiry is left as it is.
+func (m *SnippetModel) Restore(id, userID, version int) error {
+	r, err := m.Revision(id, version)
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE snippets SET title = ?, content = ? WHERE id = ?`, r.Title, r.Content, id)
+	if err != nil {
+		return err
+	}
+
+	err = insertRevision(tx, id, userID, r.Title, r.Content)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,410 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/mgxnch/snippetbox/internal/models"
+)
+
+// SnippetModel implements models.SnippetStore.
+type SnippetModel struct {
+	DB *sql.DB
+}
+
+var _ models.SnippetStore = (*SnippetModel)(nil)
+
+// snippetColumns are the columns scanned by scanSnippet. Queries using them
+// must alias snippets as s and join users as u. The last column holds the
+// comma-separated names of the snippet's tags.
+const snippetColumns = `s.id, s.public_id, s.legacy, COALESCE(s.user_id, 0), COALESCE(u.name, ''), s.title, s.content, s.format, s.language, s.visibility, COALESCE(s.slug, ''), s.burn_after_reading, s.burned, s.password_hash, s.created, s.expires,
+	(SELECT group_concat(t.name, ',' ORDER BY t.name)
+	FROM snippet_tags st JOIN tags t ON t.id = st.tag_id WHERE st.snippet_id = s.id)`
+
+// scanSnippet scans a row with the snippetColumns into a Snippet.
+func scanSnippet(row models.Scanner) (*models.Snippet, error) {
+	var s models.Snippet
+	err := row.Scan(&s.ID, &s.PublicID, &s.Legacy, &s.UserID, &s.Author, &s.Title, &s.Content, &s.Format, &s.Language, &s.Visibility, &s.Slug, &s.BurnAfterReading, &s.Burned, &s.PasswordHash, &s.Created, &s.Expires, (*models.TagList)(&s.Tags))
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Insert inserts the snippet created by the user with userID into the database,
+// along with its tags and its first revision.
+func (m *SnippetModel) Insert(userID int, in models.SnippetInput) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	publicID, err := models.NewUniquePublicID(func(publicID string) (bool, error) {
+		return publicIDExists(tx, publicID)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	slug, err := models.NewSlugFor(in.Visibility)
+	if err != nil {
+		return 0, err
+	}
+
+	created := now()
+	stmt := `INSERT INTO snippets (public_id, user_id, title, content, format, language, visibility, slug, burn_after_reading, password_hash, created, expires)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?)`
+
+	result, err := tx.Exec(stmt, publicID, userID, in.Title, in.Content, in.Format, in.Language, in.Visibility, slug, in.BurnAfterReading, string(in.PasswordHash), created, created.AddDate(0, 0, in.Expires))
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	err = setTags(tx, int(id), in.Tags)
+	if err != nil {
+		return 0, err
+	}
+
+	err = insertRevision(tx, int(id), userID, in.Title, in.Content)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// publicIDExists returns true if a snippet already has the public ID.
+func publicIDExists(tx *sql.Tx, publicID string) (bool, error) {
+	var exists bool
+	err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM snippets WHERE public_id = ?)`, publicID).Scan(&exists)
+	return exists, err
+}
+
+// Get fetches the unexpired snippet with the specified id, if it is public or
+// was created by the user with userID.
+func (m *SnippetModel) Get(id, userID int) (*models.Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + `
+	FROM snippets s LEFT JOIN users u ON u.id = s.user_id
+	WHERE s.expires > ? AND s.id = ? AND (s.visibility = 'public' OR s.user_id = ?)`
+
+	return m.get(stmt, now(), id, userID)
+}
+
+// GetByPublicID is like Get, but fetches the snippet with the specified
+// public ID.
+func (m *SnippetModel) GetByPublicID(publicID string, userID int) (*models.Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + `
+	FROM snippets s LEFT JOIN users u ON u.id = s.user_id
+	WHERE s.expires > ? AND s.public_id = ? AND (s.visibility = 'public' OR s.user_id = ?)`
+
+	return m.get(stmt, now(), publicID, userID)
+}
+
+// GetBySlug fetches the unexpired snippet with the specified slug, unless it
+// is private and wasn't created by the user with userID.
+func (m *SnippetModel) GetBySlug(slug string, userID int) (*models.Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + `
+	FROM snippets s LEFT JOIN users u ON u.id = s.user_id
+	WHERE s.expires > ? AND s.slug = ? AND (s.visibility <> 'private' OR s.user_id = ?)`
+
+	return m.get(stmt, now(), slug, userID)
+}
+
+// get runs stmt with args and scans the row it returns into a Snippet.
+func (m *SnippetModel) get(stmt string, args ...any) (*models.Snippet, error) {
+	s, err := scanSnippet(m.DB.QueryRow(stmt, args...))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Latest returns the 10 most recently created unexpired public snippets,
+// leaving out burn-after-reading ones.
+func (m *SnippetModel) Latest() ([]*models.Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + `
+	FROM snippets s LEFT JOIN users u ON u.id = s.user_id
+	WHERE s.expires > ? AND s.visibility = 'public' AND NOT s.burn_after_reading
+	ORDER BY s.id DESC LIMIT 10`
+
+	return m.query(stmt, now())
+}
+
+// List returns a page of the unexpired public snippets, leaving out
+// burn-after-reading ones, as described by opts.
+func (m *SnippetModel) List(opts models.ListOptions) (*models.SnippetList, error) {
+	stmt := `SELECT ` + snippetColumns + `
+	FROM snippets s LEFT JOIN users u ON u.id = s.user_id
+	WHERE s.expires > ? AND s.visibility = 'public' AND NOT s.burn_after_reading`
+	args := []any{now()}
+
+	if opts.Tag != "" {
+		stmt += ` AND EXISTS (SELECT 1 FROM snippet_tags st JOIN tags t ON t.id = st.tag_id
+		WHERE st.snippet_id = s.id AND t.name = ?)`
+		args = append(args, opts.Tag)
+	}
+
+	if opts.Language != "" {
+		stmt += ` AND s.language = ?`
+		args = append(args, opts.Language)
+	}
+
+	cursor, ascending := opts.Keyset()
+	if cursor != 0 && ascending {
+		stmt += ` AND s.id > ?`
+		args = append(args, cursor)
+	} else if cursor != 0 {
+		stmt += ` AND s.id < ?`
+		args = append(args, cursor)
+	}
+
+	if ascending {
+		stmt += ` ORDER BY s.id ASC LIMIT ?`
+	} else {
+		stmt += ` ORDER BY s.id DESC LIMIT ?`
+	}
+	args = append(args, opts.Size+1)
+
+	snippets, err := m.query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.NewSnippetList(opts, snippets), nil
+}
+
+// ByUser returns every snippet created by the user with userID, newest first,
+// including expired ones.
+func (m *SnippetModel) ByUser(userID int) ([]*models.Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + `
+	FROM snippets s LEFT JOIN users u ON u.id = s.user_id
+	WHERE s.user_id = ? ORDER BY s.id DESC`
+
+	return m.query(stmt, userID)
+}
+
+// Search returns the given page of the snippets that match query, best match
+// first. Only unexpired public snippets without a password match, along with
+// every snippet created by the user with userID.
+func (m *SnippetModel) Search(query string, userID, page int) (*models.SearchResults, error) {
+	results := models.NewSearchResults(query, page)
+	if len(results.Terms) == 0 {
+		return results, nil
+	}
+
+	// Match any of the terms, like MySQL's natural language mode. They are
+	// quoted so that FTS5 doesn't take words such as NOT as operators.
+	match := `"` + strings.Join(results.Terms, `" OR "`) + `"`
+	from := `FROM snippets_fts f JOIN snippets s ON s.id = f.rowid LEFT JOIN users u ON u.id = s.user_id
+	WHERE snippets_fts MATCH ? AND (s.user_id = ? OR (s.expires > ? AND s.visibility = 'public' AND NOT s.burn_after_reading AND s.password_hash IS NULL))`
+
+	at := now()
+	err := m.DB.QueryRow(`SELECT COUNT(*) `+from, match, userID, at).Scan(&results.Total)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := `SELECT ` + snippetColumns + ` ` + from + `
+	ORDER BY f.rank, s.id DESC LIMIT ? OFFSET ?`
+
+	results.Snippets, err = m.query(stmt, match, userID, at, models.SearchPageSize, (results.Page-1)*models.SearchPageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// query runs stmt with args and scans every row of the resultset into a Snippet.
+func (m *SnippetModel) query(stmt string, args ...any) ([]*models.Snippet, error) {
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snippets []*models.Snippet
+	for rows.Next() {
+		s, err := scanSnippet(rows)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// Update publishes a new revision of the snippet with the specified id, made by
+// the user with userID, replaces its other fields and resets the snippet's
+// expiry. The snippet keeps its slug, if it has one, when it is made unlisted
+// again.
+func (m *SnippetModel) Update(id, userID int, in models.SnippetInput) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	slug, err := models.NewSlugFor(in.Visibility)
+	if err != nil {
+		return err
+	}
+
+	stmt := `UPDATE snippets SET title = ?, content = ?, format = ?, language = ?, visibility = ?,
+	slug = COALESCE(slug, ?), burn_after_reading = ?, password_hash = NULLIF(?, ''), expires = ? WHERE id = ?`
+
+	_, err = tx.Exec(stmt, in.Title, in.Content, in.Format, in.Language, in.Visibility, slug, in.BurnAfterReading, string(in.PasswordHash), now().AddDate(0, 0, in.Expires), id)
+	if err != nil {
+		return err
+	}
+
+	err = setTags(tx, id, in.Tags)
+	if err != nil {
+		return err
+	}
+
+	err = insertRevision(tx, id, userID, in.Title, in.Content)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Burn marks the unexpired burn-after-reading snippet with the specified id as
+// burned, erases its content and revisions, and returns it as it was before
+// it was erased. Only the first call for a snippet succeeds, even when several
+// run at once. The others return models.ErrNoRecord.
+func (m *SnippetModel) Burn(id int) (*models.Snippet, error) {
+	// Transactions take the write lock when they begin (_txlock=immediate), so
+	// concurrent calls wait for this one and then find the snippet already
+	// burned
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt := `UPDATE snippets SET burned = TRUE
+	WHERE id = ? AND burn_after_reading AND NOT burned AND expires > ?`
+
+	result, err := tx.Exec(stmt, id, now())
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, models.ErrNoRecord
+	}
+
+	stmt = `SELECT ` + snippetColumns + `
+	FROM snippets s LEFT JOIN users u ON u.id = s.user_id
+	WHERE s.id = ?`
+
+	s, err := scanSnippet(tx.QueryRow(stmt, id))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`UPDATE snippets SET content = '' WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM snippet_revisions WHERE snippet_id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Delete removes the snippet with the specified id. It returns
+// models.ErrNoRecord if no such snippet exists.
+func (m *SnippetModel) Delete(id int) error {
+	result, err := m.DB.Exec(`DELETE FROM snippets WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
+
+// PurgeExpired deletes every snippet that expired before the given time, along
+// with its revisions, and returns how many snippets were deleted. If archive
+// is true, the snippets are copied to the snippets_archive table first, with
+// their tags but without their revisions.
+func (m *SnippetModel) PurgeExpired(before time.Time, archive bool) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if archive {
+		stmt := `INSERT INTO snippets_archive (id, public_id, user_id, title, content, format, language, visibility, slug, password_hash, tags, created, expires, archived)
+		SELECT s.id, s.public_id, s.user_id, s.title, s.content, s.format, s.language, s.visibility, s.slug, s.password_hash,
+			(SELECT group_concat(t.name, ',' ORDER BY t.name)
+			FROM snippet_tags st JOIN tags t ON t.id = st.tag_id WHERE st.snippet_id = s.id),
+			s.created, s.expires, ? FROM snippets s
+		WHERE s.expires < ?`
+
+		_, err = tx.Exec(stmt, now(), before.UTC())
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	result, err := tx.Exec(`DELETE FROM snippets WHERE expires < ?`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
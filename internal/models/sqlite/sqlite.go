@@ -0,0 +1,61 @@
+// Package sqlite implements the storage interfaces of the models package with
+// an SQLite database, using a pure-Go driver so that no C toolchain or
+// database server is needed.
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Open opens the SQLite database file at path, creating the file if it doesn't
+// exist yet, and verifies that a connection can be established. The tables are
+// created by the migrations in the migrations package.
+func Open(path string) (*sql.DB, error) {
+	// Every connection enforces foreign keys and waits for locks instead of
+	// failing straight away. Transactions take the write lock up front, so two
+	// of them can't deadlock while upgrading from a read lock. Times are stored
+	// in a format that sorts the same way as the times themselves.
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Set("_txlock", "immediate")
+	params.Set("_time_format", "sqlite")
+
+	db, err := sql.Open("sqlite", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// now returns the current time in UTC. Unlike MySQL's UTC_TIMESTAMP(), SQLite's
+// own date functions don't produce the format used by the driver, so times are
+// always passed in as parameters.
+func now() time.Time {
+	return time.Now().UTC()
+}
+
+// isUniqueViolation returns true if err was caused by inserting a duplicate
+// value into column, e.g. "users.email".
+func isUniqueViolation(err error, column string) bool {
+	var sqliteError *sqlite.Error
+	if errors.As(err, &sqliteError) {
+		return sqliteError.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE &&
+			strings.Contains(sqliteError.Error(), column)
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package sqlite
+
+import (
+	"database/sql"
+
+	"github.com/mgxnch/snippetbox/internal/models"
+)
+
+// setTags replaces the tags of the snippet with snippetID as part of tx,
+// creating the tags that don't exist yet.
+func setTags(tx *sql.Tx, snippetID int, tags []string) error {
+	_, err := tx.Exec(`DELETE FROM snippet_tags WHERE snippet_id = ?`, snippetID)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range tags {
+		_, err = tx.Exec(`INSERT INTO tags (name) VALUES (?) ON CONFLICT (name) DO NOTHING`, name)
+		if err != nil {
+			return err
+		}
+
+		stmt := `INSERT INTO snippet_tags (snippet_id, tag_id) SELECT ?, id FROM tags WHERE name = ?`
+		_, err = tx.Exec(stmt, snippetID, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TagCounts returns the n tags with the most unexpired public snippets, leaving
+// out burn-after-reading ones, along with the number of those snippets, most
+// used first.
+func (m *SnippetModel) TagCounts(n int) ([]*models.TagCount, error) {
+	stmt := `SELECT t.name, COUNT(*) FROM tags t
+	JOIN snippet_tags st ON st.tag_id = t.id
+	JOIN snippets s ON s.id = st.snippet_id
+	WHERE s.expires > ? AND s.visibility = 'public' AND NOT s.burn_after_reading
+	GROUP BY t.name ORDER BY COUNT(*) DESC, t.name LIMIT ?`
+
+	rows, err := m.DB.Query(stmt, now(), n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []*models.TagCount
+	for rows.Next() {
+		var c models.TagCount
+		if err = rows.Scan(&c.Name, &c.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, &c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,117 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/mgxnch/snippetbox/internal/models"
+)
+
+// TokenModel implements models.TokenStore.
+type TokenModel struct {
+	DB *sql.DB
+}
+
+var _ models.TokenStore = (*TokenModel)(nil)
+
+// Insert creates a new token for the user with userID and returns its plaintext.
+// The token expires after ttl, or never if ttl is 0.
+func (m *TokenModel) Insert(userID int, name, scope string, ttl time.Duration) (string, error) {
+	plaintext, err := models.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	created := now()
+	var expires sql.NullTime
+	if ttl > 0 {
+		expires = sql.NullTime{Time: created.Add(ttl), Valid: true}
+	}
+
+	stmt := `INSERT INTO tokens (user_id, name, hash, scope, created, expires)
+	VALUES (?, ?, ?, ?, ?, ?)`
+
+	_, err = m.DB.Exec(stmt, userID, name, models.HashToken(plaintext), scope, created, expires)
+	if err != nil {
+		return "", err
+	}
+
+	return plaintext, nil
+}
+
+// Authenticate looks up the unexpired token with the given plaintext and records
+// that it has been used. It returns models.ErrInvalidCredentials if there is no
+// such token.
+func (m *TokenModel) Authenticate(plaintext string) (*models.Token, error) {
+	stmt := `SELECT id, user_id, name, scope, created, last_used, expires FROM tokens
+	WHERE hash = ? AND (expires IS NULL OR expires > ?)`
+
+	t, err := models.ScanToken(m.DB.QueryRow(stmt, models.HashToken(plaintext), now()))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	_, err = m.DB.Exec(`UPDATE tokens SET last_used = ? WHERE id = ?`, now(), t.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// ForUser returns every token of the user with userID, including expired ones.
+func (m *TokenModel) ForUser(userID int) ([]*models.Token, error) {
+	stmt := `SELECT id, user_id, name, scope, created, last_used, expires FROM tokens
+	WHERE user_id = ? ORDER BY id DESC`
+
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*models.Token
+	for rows.Next() {
+		t, err := models.ScanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// Revoke deletes the token with the specified id, if it belongs to the user
+// with userID. It returns models.ErrNoRecord if there is no such token.
+func (m *TokenModel) Revoke(id, userID int) error {
+	result, err := m.DB.Exec(`DELETE FROM tokens WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
+
+// RevokeAll deletes every token of the user with userID, e.g. after their
+// password has been reset.
+func (m *TokenModel) RevokeAll(userID int) error {
+	_, err := m.DB.Exec(`DELETE FROM tokens WHERE user_id = ?`, userID)
+	return err
+}
@@ -0,0 +1,136 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/mgxnch/snippetbox/internal/models"
+)
+
+// TwoFactorModel implements models.TwoFactorStore.
+type TwoFactorModel struct {
+	DB *sql.DB
+}
+
+var _ models.TwoFactorStore = (*TwoFactorModel)(nil)
+
+// Get fetches the two-factor settings of the user with userID. It returns
+// models.ErrNoRecord if the user hasn't turned on two-factor authentication.
+func (m *TwoFactorModel) Get(userID int) (*models.TwoFactor, error) {
+	var t models.TwoFactor
+
+	stmt := `SELECT user_id, secret, last_step, created,
+	(SELECT COUNT(*) FROM recovery_codes r WHERE r.user_id = t.user_id)
+	FROM two_factor t WHERE user_id = ?`
+
+	err := m.DB.QueryRow(stmt, userID).Scan(&t.UserID, &t.Secret, &t.LastStep, &t.Created, &t.RecoveryCodes)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// Enable turns on two-factor authentication for the user with userID, with
+// the given TOTP secret and recovery codes, whose hashes are stored. Earlier
+// settings and recovery codes of the user are replaced.
+func (m *TwoFactorModel) Enable(userID int, secret string, recoveryCodes []string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = deleteTwoFactor(tx, userID); err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO two_factor (user_id, secret, created) VALUES (?, ?, ?)`
+	if _, err = tx.Exec(stmt, userID, secret, now()); err != nil {
+		return err
+	}
+
+	for _, code := range recoveryCodes {
+		_, err = tx.Exec(`INSERT INTO recovery_codes (user_id, hash) VALUES (?, ?)`, userID, models.HashToken(code))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Disable turns off two-factor authentication for the user with userID, and
+// deletes their recovery codes.
+func (m *TwoFactorModel) Disable(userID int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = deleteTwoFactor(tx, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// deleteTwoFactor deletes the two-factor settings and recovery codes of the
+// user with userID in tx.
+func deleteTwoFactor(tx *sql.Tx, userID int) error {
+	_, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM two_factor WHERE user_id = ?`, userID)
+	return err
+}
+
+// UseStep records that the user with userID has used the TOTP code of the
+// given time step. It returns models.ErrInvalidCredentials if a code of that
+// step or a later one has already been used, so that an intercepted code can't
+// be replayed. Only one of several concurrent calls with the same step
+// succeeds.
+func (m *TwoFactorModel) UseStep(userID int, step int64) error {
+	stmt := `UPDATE two_factor SET last_step = ? WHERE user_id = ? AND last_step < ?`
+
+	result, err := m.DB.Exec(stmt, step, userID, step)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrInvalidCredentials
+	}
+
+	return nil
+}
+
+// UseRecoveryCode uses up one of the recovery codes of the user with userID.
+// It returns models.ErrInvalidCredentials if the user has no such unused code.
+func (m *TwoFactorModel) UseRecoveryCode(userID int, code string) error {
+	stmt := `DELETE FROM recovery_codes WHERE user_id = ? AND hash = ?`
+
+	result, err := m.DB.Exec(stmt, userID, models.HashToken(models.NormalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrInvalidCredentials
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/mgxnch/snippetbox/internal/models"
+)
+
+// UserModel implements models.UserStore.
+type UserModel struct {
+	DB         *sql.DB
+	BcryptCost int // 0 means models.DefaultBcryptCost
+}
+
+var _ models.UserStore = (*UserModel)(nil)
+
+// Insert inserts a user into the database. It returns models.ErrDuplicateEmail
+// if the email is already in use.
+func (m *UserModel) Insert(name, email, password string) error {
+	hashedPassword, err := models.HashPassword(password, m.BcryptCost)
+	if err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO users (name, email, hashed_password, created)
+	VALUES (?, ?, ?, ?)`
+
+	_, err = m.DB.Exec(stmt, name, email, string(hashedPassword), now())
+	if err != nil {
+		if isUniqueViolation(err, "users.email") {
+			return models.ErrDuplicateEmail
+		}
+		return err
+	}
+	return nil
+}
+
+// Authenticate verifies whether a user with the email and password exists.
+// It returns the user's ID if they do. Otherwise, this returns 0 and an error.
+func (m *UserModel) Authenticate(email, password string) (int, error) {
+	var id int
+	var hashedPassword []byte
+
+	stmt := "SELECT id, hashed_password FROM users WHERE email = ?"
+	err := m.DB.QueryRow(stmt, email).Scan(&id, &hashedPassword)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, models.ErrInvalidCredentials
+		}
+		return 0, err
+	}
+
+	err = models.CheckPassword(hashedPassword, password)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// Exists checks if a user with a specific ID exists.
+func (m *UserModel) Exists(id int) (bool, error) {
+	var exists bool
+
+	stmt := "SELECT EXISTS(SELECT true FROM users WHERE id = ?)"
+	err := m.DB.QueryRow(stmt, id).Scan(&exists)
+	return exists, err
+}
+
+// Get fetches the user with the specified id.
+func (m *UserModel) Get(id int) (*models.User, error) {
+	var user models.User
+
+	stmt := "SELECT id, name, email, email_verified, created FROM users WHERE id = ?"
+	err := m.DB.QueryRow(stmt, id).Scan(&user.ID, &user.Name, &user.Email, &user.EmailVerified, &user.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// GetByEmail fetches the user with the specified email. It returns
+// models.ErrNoRecord if there is no such user.
+func (m *UserModel) GetByEmail(email string) (*models.User, error) {
+	var user models.User
+
+	stmt := "SELECT id, name, email, email_verified, created FROM users WHERE email = ?"
+	err := m.DB.QueryRow(stmt, email).Scan(&user.ID, &user.Name, &user.Email, &user.EmailVerified, &user.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// UpdatePassword replaces the password of the user with the specified id. It
+// returns models.ErrNoRecord if there is no such user.
+func (m *UserModel) UpdatePassword(id int, password string) error {
+	hashedPassword, err := models.HashPassword(password, m.BcryptCost)
+	if err != nil {
+		return err
+	}
+
+	stmt := "UPDATE users SET hashed_password = ? WHERE id = ?"
+	result, err := m.DB.Exec(stmt, string(hashedPassword), id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
+
+// VerifyEmail marks the email address of the user with the specified id as
+// verified.
+func (m *UserModel) VerifyEmail(id int) error {
+	stmt := "UPDATE users SET email_verified = TRUE WHERE id = ?"
+	_, err := m.DB.Exec(stmt, id)
+	return err
+}
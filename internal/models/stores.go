@@ -0,0 +1,86 @@
+package models
+
+import "time"
+
+// The interfaces below are implemented by every storage backend. SnippetModel,
+// UserModel, TokenModel, PasswordResetModel, TwoFactorModel and PasskeyModel
+// are the MySQL implementations, and the sqlite and memory subpackages hold
+// the others.
+
+// SnippetStore stores snippets and their revisions.
+type SnippetStore interface {
+	Insert(userID int, in SnippetInput) (int, error)
+	Get(id, userID int) (*Snippet, error)
+	GetByPublicID(publicID string, userID int) (*Snippet, error)
+	GetBySlug(slug string, userID int) (*Snippet, error)
+	Latest() ([]*Snippet, error)
+	List(opts ListOptions) (*SnippetList, error)
+	ByUser(userID int) ([]*Snippet, error)
+	Search(query string, userID, page int) (*SearchResults, error)
+	TagCounts(n int) ([]*TagCount, error)
+	Update(id, userID int, in SnippetInput) error
+	Burn(id int) (*Snippet, error)
+	Delete(id int) error
+	Revisions(snippetID int) ([]*Revision, error)
+	Revision(snippetID, version int) (*Revision, error)
+	Restore(id, userID, version int) error
+	PurgeExpired(before time.Time, archive bool) (int, error)
+}
+
+// UserStore stores users and their credentials.
+type UserStore interface {
+	Insert(name, email, password string) error
+	Authenticate(email, password string) (int, error)
+	Exists(id int) (bool, error)
+	Get(id int) (*User, error)
+	GetByEmail(email string) (*User, error)
+	UpdatePassword(id int, password string) error
+	VerifyEmail(id int) error
+}
+
+// TokenStore stores the API tokens of users.
+type TokenStore interface {
+	Insert(userID int, name, scope string, ttl time.Duration) (string, error)
+	Authenticate(plaintext string) (*Token, error)
+	ForUser(userID int) ([]*Token, error)
+	Revoke(id, userID int) error
+	RevokeAll(userID int) error
+}
+
+// PasswordResetStore stores the tokens that let users who forgot their
+// password choose a new one.
+type PasswordResetStore interface {
+	Insert(userID int, ttl time.Duration) (string, error)
+	Get(plaintext string) (*PasswordReset, error)
+	Redeem(plaintext string) (int, error)
+}
+
+// TwoFactorStore stores the TOTP secrets and recovery codes of users who have
+// turned on two-factor authentication.
+type TwoFactorStore interface {
+	Get(userID int) (*TwoFactor, error)
+	Enable(userID int, secret string, recoveryCodes []string) error
+	Disable(userID int) error
+	UseStep(userID int, step int64) error
+	UseRecoveryCode(userID int, code string) error
+}
+
+// PasskeyStore stores the WebAuthn credentials that let users log in without
+// a password.
+type PasskeyStore interface {
+	Insert(p *Passkey) (int, error)
+	ForUser(userID int) ([]*Passkey, error)
+	Use(id int, signCount uint32) error
+	Rename(id, userID int, name string) error
+	Revoke(id, userID int) error
+}
+
+// Compile-time checks that the MySQL models implement the interfaces.
+var (
+	_ SnippetStore       = (*SnippetModel)(nil)
+	_ UserStore          = (*UserModel)(nil)
+	_ TokenStore         = (*TokenModel)(nil)
+	_ PasswordResetStore = (*PasswordResetModel)(nil)
+	_ TwoFactorStore     = (*TwoFactorModel)(nil)
+	_ PasskeyStore       = (*PasskeyModel)(nil)
+)
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// tagsColumn selects the names of a snippet's tags as a comma-separated list,
+// to be scanned into a TagList. Queries using it must alias snippets as s.
+const tagsColumn = `(SELECT GROUP_CONCAT(t.name ORDER BY t.name SEPARATOR ',')
+	FROM snippet_tags st JOIN tags t ON t.id = st.tag_id WHERE st.snippet_id = s.id)`
+
+// TagCount holds the number of unexpired snippets with a tag.
+type TagCount struct {
+	Name  string
+	Count int
+}
+
+// TagList scans a comma-separated list of tag names, or NULL for none, into a
+// slice. Tag names can't contain commas.
+type TagList []string
+
+// Scan implements the sql.Scanner interface.
+func (l *TagList) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*l = nil
+	case string:
+		*l = strings.Split(v, ",")
+	case []byte:
+		*l = strings.Split(string(v), ",")
+	default:
+		return fmt.Errorf("models: cannot scan %T into a TagList", src)
+	}
+	return nil
+}
+
+// setTags replaces the tags of the snippet with snippetID as part of tx,
+// creating the tags that don't exist yet.
+func setTags(tx *sql.Tx, snippetID int, tags []string) error {
+	_, err := tx.Exec(`DELETE FROM snippet_tags WHERE snippet_id = ?`, snippetID)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range tags {
+		_, err = tx.Exec(`INSERT INTO tags (name) VALUES (?) ON DUPLICATE KEY UPDATE name = name`, name)
+		if err != nil {
+			return err
+		}
+
+		stmt := `INSERT INTO snippet_tags (snippet_id, tag_id) SELECT ?, id FROM tags WHERE name = ?`
+		_, err = tx.Exec(stmt, snippetID, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TagCounts returns the n tags with the most unexpired public snippets, leaving
+// out burn-after-reading ones, along with the number of those snippets, most
+// used first.
+func (m *SnippetModel) TagCounts(n int) ([]*TagCount, error) {
+	stmt := `SELECT t.name, COUNT(*) FROM tags t
+	JOIN snippet_tags st ON st.tag_id = t.id
+	JOIN snippets s ON s.id = st.snippet_id
+	WHERE s.expires > UTC_TIMESTAMP() AND s.visibility = 'public' AND NOT s.burn_after_reading
+	GROUP BY t.name ORDER BY COUNT(*) DESC, t.name LIMIT ?`
+
+	rows, err := m.DB.Query(stmt, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []*TagCount
+	for rows.Next() {
+		var c TagCount
+		if err = rows.Scan(&c.Name, &c.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, &c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
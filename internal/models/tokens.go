@@ -0,0 +1,188 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// Scopes that limit what a Token can be used for.
+const (
+	ScopeRead  = "read"  // only safe (read-only) requests
+	ScopeWrite = "write" // every request the user could make
+)
+
+// tokenPrefix makes tokens easy to recognise, e.g. by secret scanners.
+const tokenPrefix = "sbx_"
+
+// Token holds the data from the tokens table. The plaintext of a token is only
+// ever returned by TokenModel.Insert; the table holds its SHA-256 hash.
+type Token struct {
+	ID       int
+	UserID   int
+	Name     string
+	Scope    string
+	Created  time.Time
+	LastUsed time.Time // zero if the token has never been used
+	Expires  time.Time // zero if the token never expires
+}
+
+// Expired returns true if the token has an expiry time and it has passed.
+func (t *Token) Expired() bool {
+	return !t.Expires.IsZero() && !t.Expires.After(time.Now())
+}
+
+// CanWrite returns true if the token may be used for requests that change data.
+func (t *Token) CanWrite() bool {
+	return t.Scope == ScopeWrite
+}
+
+// TokenModel interacts with the database.
+type TokenModel struct {
+	DB *sql.DB
+}
+
+// HashToken returns the hex-encoded SHA-256 hash of a plaintext token. Tokens
+// are long and random, so unlike passwords they don't need a slow hash.
+func HashToken(plaintext string) string {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(hash[:])
+}
+
+// GenerateToken returns the plaintext of a new random token.
+func GenerateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return tokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Insert creates a new token for the user with userID and returns its plaintext.
+// The token expires after ttl, or never if ttl is 0.
+func (m *TokenModel) Insert(userID int, name, scope string, ttl time.Duration) (string, error) {
+	plaintext, err := GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	var expires sql.NullTime
+	if ttl > 0 {
+		expires = sql.NullTime{Time: time.Now().UTC().Add(ttl), Valid: true}
+	}
+
+	stmt := `INSERT INTO tokens (user_id, name, hash, scope, created, expires)
+	VALUES (?, ?, ?, ?, UTC_TIMESTAMP(), ?)`
+
+	_, err = m.DB.Exec(stmt, userID, name, HashToken(plaintext), scope, expires)
+	if err != nil {
+		return "", err
+	}
+
+	return plaintext, nil
+}
+
+// Authenticate looks up the unexpired token with the given plaintext and records
+// that it has been used. It returns ErrInvalidCredentials if there is no such token.
+func (m *TokenModel) Authenticate(plaintext string) (*Token, error) {
+	stmt := `SELECT id, user_id, name, scope, created, last_used, expires FROM tokens
+	WHERE hash = ? AND (expires IS NULL OR expires > UTC_TIMESTAMP())`
+
+	t, err := ScanToken(m.DB.QueryRow(stmt, HashToken(plaintext)))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	stmt = `UPDATE tokens SET last_used = UTC_TIMESTAMP() WHERE id = ?`
+	_, err = m.DB.Exec(stmt, t.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// ForUser returns every token of the user with userID, including expired ones.
+func (m *TokenModel) ForUser(userID int) ([]*Token, error) {
+	stmt := `SELECT id, user_id, name, scope, created, last_used, expires FROM tokens
+	WHERE user_id = ? ORDER BY id DESC`
+
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*Token
+	for rows.Next() {
+		t, err := ScanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// Revoke deletes the token with the specified id, if it belongs to the user
+// with userID. It returns ErrNoRecord if there is no such token.
+func (m *TokenModel) Revoke(id, userID int) error {
+	stmt := `DELETE FROM tokens WHERE id = ? AND user_id = ?`
+
+	result, err := m.DB.Exec(stmt, id, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// RevokeAll deletes every token of the user with userID, e.g. after their
+// password has been reset.
+func (m *TokenModel) RevokeAll(userID int) error {
+	stmt := `DELETE FROM tokens WHERE user_id = ?`
+
+	_, err := m.DB.Exec(stmt, userID)
+	return err
+}
+
+// Scanner is implemented by both *sql.Row and *sql.Rows.
+type Scanner interface {
+	Scan(dest ...any) error
+}
+
+// ScanToken scans a row with the columns id, user_id, name, scope, created,
+// last_used and expires into a Token.
+func ScanToken(row Scanner) (*Token, error) {
+	var t Token
+	var lastUsed, expires sql.NullTime
+
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Scope, &t.Created, &lastUsed, &expires)
+	if err != nil {
+		return nil, err
+	}
+	t.LastUsed = lastUsed.Time
+	t.Expires = expires.Time
+
+	return &t, nil
+}
@@ -0,0 +1,177 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+)
+
+// TwoFactor holds the data from the two_factor table, of a user who has
+// turned on two-factor authentication with an authenticator app.
+type TwoFactor struct {
+	UserID        int
+	Secret        string // base32-encoded TOTP secret, see totp.GenerateSecret
+	LastStep      int64  // time step of the last code that was used
+	Created       time.Time
+	RecoveryCodes int // how many unused recovery codes the user has left
+}
+
+// recoveryCodeEncoding writes recovery codes with Crockford's base32 alphabet
+// in lower case, which leaves out the letters that are easily mixed up with
+// digits, as the codes are typed in by hand.
+var recoveryCodeEncoding = base32.NewEncoding("0123456789abcdefghjkmnpqrstvwxyz").WithPadding(base32.NoPadding)
+
+// GenerateRecoveryCodes returns n new random recovery codes, such as
+// "k7mqa-x2pdz". Each has 50 random bits, which is plenty, as each can only
+// be used once, and wrong guesses are limited.
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		b := make([]byte, 7) // 56 bits, of which the first 50 are kept
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := recoveryCodeEncoding.EncodeToString(b)[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+	return codes, nil
+}
+
+// NormalizeRecoveryCode returns a recovery code as typed in by a user the way
+// GenerateRecoveryCodes wrote it, so that its hash can be looked up. Case,
+// spaces and the dash don't matter.
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+	if len(code) != 10 {
+		return code
+	}
+	return code[:5] + "-" + code[5:]
+}
+
+// TwoFactorModel interacts with the database.
+type TwoFactorModel struct {
+	DB *sql.DB
+}
+
+// Get fetches the two-factor settings of the user with userID. It returns
+// ErrNoRecord if the user hasn't turned on two-factor authentication.
+func (m *TwoFactorModel) Get(userID int) (*TwoFactor, error) {
+	var t TwoFactor
+
+	stmt := `SELECT user_id, secret, last_step, created,
+	(SELECT COUNT(*) FROM recovery_codes r WHERE r.user_id = t.user_id)
+	FROM two_factor t WHERE user_id = ?`
+
+	err := m.DB.QueryRow(stmt, userID).Scan(&t.UserID, &t.Secret, &t.LastStep, &t.Created, &t.RecoveryCodes)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// Enable turns on two-factor authentication for the user with userID, with
+// the given TOTP secret and recovery codes, whose hashes are stored. Earlier
+// settings and recovery codes of the user are replaced.
+func (m *TwoFactorModel) Enable(userID int, secret string, recoveryCodes []string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = deleteTwoFactor(tx, userID); err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO two_factor (user_id, secret, created) VALUES (?, ?, UTC_TIMESTAMP())`
+	if _, err = tx.Exec(stmt, userID, secret); err != nil {
+		return err
+	}
+
+	for _, code := range recoveryCodes {
+		_, err = tx.Exec(`INSERT INTO recovery_codes (user_id, hash) VALUES (?, ?)`, userID, HashToken(code))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Disable turns off two-factor authentication for the user with userID, and
+// deletes their recovery codes.
+func (m *TwoFactorModel) Disable(userID int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = deleteTwoFactor(tx, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// deleteTwoFactor deletes the two-factor settings and recovery codes of the
+// user with userID in tx.
+func deleteTwoFactor(tx *sql.Tx, userID int) error {
+	_, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM two_factor WHERE user_id = ?`, userID)
+	return err
+}
+
+// UseStep records that the user with userID has used the TOTP code of the
+// given time step. It returns ErrInvalidCredentials if a code of that step or
+// a later one has already been used, so that an intercepted code can't be
+// replayed. Only one of several concurrent calls with the same step succeeds.
+func (m *TwoFactorModel) UseStep(userID int, step int64) error {
+	stmt := `UPDATE two_factor SET last_step = ? WHERE user_id = ? AND last_step < ?`
+
+	result, err := m.DB.Exec(stmt, step, userID, step)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrInvalidCredentials
+	}
+
+	return nil
+}
+
+// UseRecoveryCode uses up one of the recovery codes of the user with userID.
+// It returns ErrInvalidCredentials if the user has no such unused code.
+func (m *TwoFactorModel) UseRecoveryCode(userID int, code string) error {
+	stmt := `DELETE FROM recovery_codes WHERE user_id = ? AND hash = ?`
+
+	result, err := m.DB.Exec(stmt, userID, HashToken(NormalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrInvalidCredentials
+	}
+
+	return nil
+}
@@ -15,20 +15,43 @@ type User struct {
 	ID             int
 	Name           string
 	Email          string
+	EmailVerified  bool // whether the user has opened the link in the verification email
 	HashedPassword []byte
 	Created        time.Time
 }
 
+// DefaultBcryptCost is the bcrypt cost used by HashPassword when none is given.
+const DefaultBcryptCost = 12 // 2^12 = 4096 iterations
+
+// HashPassword returns the bcrypt hash of a plaintext password. It is shared
+// by every UserStore implementation. A cost of 0 means DefaultBcryptCost.
+func HashPassword(password string, cost int) ([]byte, error) {
+	if cost == 0 {
+		cost = DefaultBcryptCost
+	}
+	return bcrypt.GenerateFromPassword([]byte(password), cost)
+}
+
+// CheckPassword compares a bcrypt hash with a plaintext password. It returns
+// ErrInvalidCredentials if they don't match.
+func CheckPassword(hashedPassword []byte, password string) error {
+	err := bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrInvalidCredentials
+	}
+	return err
+}
+
 // UserModel interacts with the database.
 type UserModel struct {
-	DB *sql.DB
+	DB         *sql.DB
+	BcryptCost int // 0 means DefaultBcryptCost
 }
 
 // Insert inserts a user into the database. It checks that the email is unique and that
 // the password can be converted into a valid bcrypt hash.
 func (m *UserModel) Insert(name, email, password string) error {
-	// Create bcrupt hash of plaintext password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12) // 2^12 = 4096 iterations
+	hashedPassword, err := HashPassword(password, m.BcryptCost)
 	if err != nil {
 		return err
 	}
@@ -70,11 +93,8 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 	}
 
 	// Check if password is correct
-	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	err = CheckPassword(hashedPassword, password)
 	if err != nil {
-		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-			return 0, ErrInvalidCredentials
-		}
 		return 0, err
 	}
 
@@ -90,3 +110,69 @@ func (m *UserModel) Exists(id int) (bool, error) {
 	err := m.DB.QueryRow(stmt, id).Scan(&exists)
 	return exists, err
 }
+
+// Get fetches the user with the specified id.
+func (m *UserModel) Get(id int) (*User, error) {
+	var user User
+
+	stmt := "SELECT id, name, email, email_verified, created FROM users WHERE id = ?"
+	err := m.DB.QueryRow(stmt, id).Scan(&user.ID, &user.Name, &user.Email, &user.EmailVerified, &user.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// GetByEmail fetches the user with the specified email. It returns ErrNoRecord
+// if there is no such user.
+func (m *UserModel) GetByEmail(email string) (*User, error) {
+	var user User
+
+	stmt := "SELECT id, name, email, email_verified, created FROM users WHERE email = ?"
+	err := m.DB.QueryRow(stmt, email).Scan(&user.ID, &user.Name, &user.Email, &user.EmailVerified, &user.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// UpdatePassword replaces the password of the user with the specified id. It
+// returns ErrNoRecord if there is no such user.
+func (m *UserModel) UpdatePassword(id int, password string) error {
+	hashedPassword, err := HashPassword(password, m.BcryptCost)
+	if err != nil {
+		return err
+	}
+
+	stmt := "UPDATE users SET hashed_password = ? WHERE id = ?"
+	result, err := m.DB.Exec(stmt, string(hashedPassword), id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// VerifyEmail marks the email address of the user with the specified id as
+// verified.
+func (m *UserModel) VerifyEmail(id int) error {
+	stmt := "UPDATE users SET email_verified = TRUE WHERE id = ?"
+	_, err := m.DB.Exec(stmt, id)
+	return err
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+)
+
+// The visibilities of a snippet, which decide who can see it.
+const (
+	// VisibilityPublic snippets can be seen by anyone, and are listed and
+	// searchable.
+	VisibilityPublic = "public"
+	// VisibilityUnlisted snippets can be seen by anyone who knows their slug,
+	// but only their owner can find them by public ID.
+	VisibilityUnlisted = "unlisted"
+	// VisibilityPrivate snippets can only be seen by their owner.
+	VisibilityPrivate = "private"
+)
+
+// NewSlug returns a new random slug for an unlisted snippet. It is long enough
+// that slugs can't be guessed, and can never be mistaken for an ID.
+func NewSlug() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "u" + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// NewSlugFor returns a new slug for a snippet with the given visibility, or
+// NULL if the snippet doesn't need one because it isn't unlisted.
+func NewSlugFor(visibility string) (sql.NullString, error) {
+	if visibility != VisibilityUnlisted {
+		return sql.NullString{}, nil
+	}
+
+	slug, err := NewSlug()
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: slug, Valid: true}, nil
+}
+
+// Ref returns how URLs refer to the snippet: by its slug if it is unlisted, so
+// that the URLs can be shared, or by its public ID otherwise.
+func (s *Snippet) Ref() string {
+	if s.Visibility == VisibilityUnlisted && s.Slug != "" {
+		return s.Slug
+	}
+	return s.PublicID
+}
+
+// VisibleTo returns true if the user with userID may see the snippet when they
+// look it up by ID or public ID. Unlisted snippets must be looked up by slug
+// instead, except by their owner.
+func (s *Snippet) VisibleTo(userID int) bool {
+	return s.Visibility == VisibilityPublic || (userID != 0 && s.UserID == userID)
+}
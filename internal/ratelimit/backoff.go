@@ -0,0 +1,158 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Backoff makes a key wait after each of its failures, such as wrong
+// passwords, twice as long as after the previous one, starting from base, and
+// locks it out for lockout once it has failed max times in a row. The failures
+// of a key are forgotten when it is Reset, or once lockout has passed since the
+// last one. Like a Limiter, a Backoff only keeps its state in memory and is
+// safe for concurrent use.
+type Backoff struct {
+	base    time.Duration
+	max     int
+	lockout time.Duration
+
+	mu        sync.Mutex
+	failures  map[string]failures
+	lastPrune time.Time
+}
+
+// failures are the failures in a row of a key, and its attempts which have
+// been let in by Try but haven't failed or been cancelled yet.
+type failures struct {
+	count   int
+	last    time.Time
+	pending int
+}
+
+// NewBackoff returns a Backoff which makes a key wait base after its first
+// failure, and locks it out for lockout after max failures in a row.
+func NewBackoff(base time.Duration, max int, lockout time.Duration) *Backoff {
+	return &Backoff{
+		base:     base,
+		max:      max,
+		lockout:  lockout,
+		failures: make(map[string]failures),
+	}
+}
+
+// Try returns true if key may try now, in which case the attempt must be
+// followed by one of Fail, Cancel or Reset once it is known whether it failed.
+// Only failures make key wait, but attempts which are still pending count
+// towards max, so that concurrent attempts can't all get in before any of them
+// has failed. If key may not try now, Try returns how long until it may.
+func (b *Backoff) Try(key string) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.prune(now)
+
+	f := b.current(key, now)
+	if f.count > 0 {
+		if wait := f.last.Add(b.delay(f.count)).Sub(now); wait > 0 {
+			return false, wait
+		}
+	}
+	if f.count+f.pending >= b.max {
+		return false, b.delay(f.count + f.pending)
+	}
+
+	f.pending++
+	b.failures[key] = f
+	return true, 0
+}
+
+// Fail records that an attempt of key let in by Try has failed, and returns
+// true if key is now locked out, which is so for exactly one failure per
+// lockout.
+func (b *Backoff) Fail(key string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	f := b.current(key, now)
+	if f.pending > 0 {
+		f.pending--
+	}
+	f.count++
+	f.last = now
+	b.failures[key] = f
+
+	return f.count == b.max
+}
+
+// Cancel takes back an attempt of key let in by Try which didn't fail, without
+// forgetting the earlier failures of key.
+func (b *Backoff) Cancel(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	f := b.current(key, time.Now())
+	if f.pending > 0 {
+		f.pending--
+	}
+	b.store(key, f)
+}
+
+// Reset forgets the failures of key, e.g. after it has succeeded, including
+// the attempt let in by Try.
+func (b *Backoff) Reset(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.failures, key)
+}
+
+// delay returns how long a key must wait after count failures in a row.
+func (b *Backoff) delay(count int) time.Duration {
+	if count >= b.max {
+		return b.lockout
+	}
+
+	d := b.base
+	for i := 1; i < count && d < b.lockout; i++ {
+		d *= 2
+	}
+	return min(d, b.lockout)
+}
+
+// current returns the failures of key, forgetting them if lockout has passed
+// since the last one. b.mu must be held.
+func (b *Backoff) current(key string, now time.Time) failures {
+	f := b.failures[key]
+	if f.count > 0 && now.Sub(f.last) >= b.lockout {
+		f.count = 0
+		f.last = time.Time{}
+		b.store(key, f)
+	}
+	return f
+}
+
+// store saves f as the failures of key, or deletes them if there is nothing
+// left to remember. b.mu must be held.
+func (b *Backoff) store(key string, f failures) {
+	if f.count == 0 && f.pending == 0 {
+		delete(b.failures, key)
+		return
+	}
+	b.failures[key] = f
+}
+
+// prune forgets the failures of every key whose last one is older than
+// lockout, so that keys which are never seen again don't pile up. It only does
+// so once per lockout, as it has to look at every key. b.mu must be held.
+func (b *Backoff) prune(now time.Time) {
+	if now.Sub(b.lastPrune) < b.lockout {
+		return
+	}
+	b.lastPrune = now
+
+	for key := range b.failures {
+		b.current(key, now)
+	}
+}
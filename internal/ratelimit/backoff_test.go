@@ -0,0 +1,137 @@
+package ratelimit
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	b := NewBackoff(time.Second, 10, time.Minute)
+
+	tests := []struct {
+		count int
+		want  time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{6, 32 * time.Second},
+		{7, time.Minute}, // capped at the lockout
+		{9, time.Minute},
+		{10, time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := b.delay(tt.count); got != tt.want {
+			t.Errorf("after %d failures: got %s, want %s", tt.count, got, tt.want)
+		}
+	}
+}
+
+func TestBackoffTry(t *testing.T) {
+	b := NewBackoff(time.Hour, 10, 2*time.Hour)
+
+	if ok, _ := b.Try("a"); !ok {
+		t.Fatal("first attempt: not allowed")
+	}
+	b.Fail("a")
+
+	ok, wait := b.Try("a")
+	if ok || wait <= 59*time.Minute || wait > time.Hour {
+		t.Errorf("after a failure: got %t, %s", ok, wait)
+	}
+	if ok, _ := b.Try("b"); !ok {
+		t.Errorf("another key: not allowed")
+	}
+
+	b.Reset("a")
+	if ok, _ := b.Try("a"); !ok {
+		t.Errorf("after Reset: not allowed")
+	}
+}
+
+func TestBackoffPending(t *testing.T) {
+	b := NewBackoff(time.Hour, 10, 2*time.Hour)
+
+	// Attempts which haven't failed don't make a key wait, whether they are
+	// still pending or have been cancelled
+	if ok, _ := b.Try("a"); !ok {
+		t.Fatal("first attempt: not allowed")
+	}
+	if ok, _ := b.Try("a"); !ok {
+		t.Fatal("while the first is pending: not allowed")
+	}
+	b.Cancel("a")
+	b.Cancel("a")
+	if ok, _ := b.Try("a"); !ok {
+		t.Fatal("after Cancel: not allowed")
+	}
+	b.Cancel("a")
+
+	// Nor do they push back the wait after an earlier failure
+	b = NewBackoff(20*time.Millisecond, 10, time.Hour)
+	b.Try("a")
+	b.Fail("a")
+	time.Sleep(30 * time.Millisecond)
+	for i := range 3 {
+		if ok, wait := b.Try("a"); !ok {
+			t.Fatalf("attempt %d after the wait: got %t, %s", i+1, ok, wait)
+		}
+		b.Cancel("a")
+	}
+}
+
+func TestBackoffLockout(t *testing.T) {
+	b := NewBackoff(0, 5, time.Hour)
+
+	var wg sync.WaitGroup
+	var allowed, lockouts atomic.Int32
+	for range 100 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, _ := b.Try("a"); !ok {
+				return
+			}
+			allowed.Add(1)
+			if b.Fail("a") {
+				lockouts.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := allowed.Load(); n != 5 {
+		t.Errorf("got %d concurrent attempts allowed, want 5", n)
+	}
+	if n := lockouts.Load(); n != 1 {
+		t.Errorf("got %d lockouts, want 1", n)
+	}
+
+	ok, wait := b.Try("a")
+	if ok || wait <= 59*time.Minute {
+		t.Errorf("during the lockout: got %t, %s", ok, wait)
+	}
+}
+
+func TestBackoffForget(t *testing.T) {
+	b := NewBackoff(0, 1, 20*time.Millisecond)
+
+	b.Try("a")
+	if !b.Fail("a") {
+		t.Fatal("first failure: not locked out")
+	}
+	if ok, _ := b.Try("a"); ok {
+		t.Fatalf("during the lockout: allowed")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if ok, _ := b.Try("a"); !ok {
+		t.Fatal("after the lockout: not allowed")
+	}
+	if !b.Fail("a") {
+		t.Errorf("failure after the lockout: not locked out")
+	}
+}
@@ -0,0 +1,135 @@
+// Package ratelimit counts recent events per key, such as wrong guesses of a
+// password per client, so that callers can refuse to go on once there have
+// been too many, or make each key wait longer after every failure.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter allows at most max events per key in any period of length window.
+// Events are only kept in memory, so the limits apply to a single process and
+// are forgotten when it restarts. A Limiter is safe for concurrent use.
+type Limiter struct {
+	max    int
+	window time.Duration
+
+	mu        sync.Mutex
+	events    map[string][]time.Time // times of the events of each key, oldest first
+	lastPrune time.Time
+}
+
+// New returns a Limiter which allows max events per key in every window.
+func New(max int, window time.Duration) *Limiter {
+	return &Limiter{
+		max:    max,
+		window: window,
+		events: make(map[string][]time.Time),
+	}
+}
+
+// Allow returns true if another event for key would stay within the limit.
+// If it would not, Allow also returns how long until it will.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	events := l.recent(key, now)
+	if len(events) < l.max {
+		return true, 0
+	}
+
+	// Another event is allowed once enough of the recent ones fall out of the
+	// window
+	return false, events[len(events)-l.max].Add(l.window).Sub(now)
+}
+
+// Add records an event for key.
+func (l *Limiter) Add(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.prune(now)
+	l.events[key] = append(l.recent(key, now), now)
+}
+
+// Try records an event for key if it stays within the limit, and returns
+// true. Checking and recording at once means that concurrent callers can't all
+// get in before any of them has recorded its event. If the event would not
+// stay within the limit, Try records nothing and returns how long until it
+// will.
+func (l *Limiter) Try(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.prune(now)
+	events := l.recent(key, now)
+	if len(events) >= l.max {
+		return false, events[len(events)-l.max].Add(l.window).Sub(now)
+	}
+
+	l.events[key] = append(events, now)
+	return true, 0
+}
+
+// Cancel forgets the latest event of key, e.g. one recorded by Try for an
+// attempt which turned out not to count.
+func (l *Limiter) Cancel(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	events := l.events[key]
+	switch len(events) {
+	case 0:
+	case 1:
+		delete(l.events, key)
+	default:
+		l.events[key] = events[:len(events)-1]
+	}
+}
+
+// Reset forgets the events of key.
+func (l *Limiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.events, key)
+}
+
+// recent returns the events of key that happened within the window before
+// now, and forgets the older ones. l.mu must be held.
+func (l *Limiter) recent(key string, now time.Time) []time.Time {
+	events := l.events[key]
+
+	start := now.Add(-l.window)
+	i := 0
+	for i < len(events) && !events[i].After(start) {
+		i++
+	}
+	events = events[i:]
+
+	if len(events) == 0 {
+		delete(l.events, key)
+	} else {
+		l.events[key] = events
+	}
+	return events
+}
+
+// prune forgets the old events of every key, so that keys which are never
+// seen again don't pile up. It only does so once per window, as it has to
+// look at every key. l.mu must be held.
+func (l *Limiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < l.window {
+		return
+	}
+	l.lastPrune = now
+
+	for key := range l.events {
+		l.recent(key, now)
+	}
+}
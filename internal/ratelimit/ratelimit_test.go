@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := New(2, time.Hour)
+
+	for i := range 2 {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("event %d: not allowed", i+1)
+		}
+		l.Add("a")
+	}
+
+	ok, wait := l.Allow("a")
+	if ok || wait <= 59*time.Minute || wait > time.Hour {
+		t.Errorf("third event: got %t, %s", ok, wait)
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Errorf("another key: not allowed")
+	}
+
+	l.Reset("a")
+	if ok, _ := l.Allow("a"); !ok {
+		t.Errorf("after Reset: not allowed")
+	}
+}
+
+func TestLimiterWindow(t *testing.T) {
+	l := New(1, 20*time.Millisecond)
+
+	l.Add("a")
+	if ok, _ := l.Allow("a"); ok {
+		t.Fatalf("within the window: allowed")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Errorf("after the window: not allowed")
+	}
+}
+
+func TestLimiterTry(t *testing.T) {
+	l := New(5, time.Hour)
+
+	var wg sync.WaitGroup
+	var allowed atomic.Int32
+	for range 100 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, _ := l.Try("a"); ok {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := allowed.Load(); n != 5 {
+		t.Fatalf("got %d concurrent events allowed, want 5", n)
+	}
+
+	ok, wait := l.Try("a")
+	if ok || wait <= 0 {
+		t.Errorf("over the limit: got %t, %s", ok, wait)
+	}
+
+	l.Cancel("a")
+	if ok, _ := l.Try("a"); !ok {
+		t.Errorf("after Cancel: not allowed")
+	}
+	if ok, _ := l.Try("a"); ok {
+		t.Errorf("after Cancel and Try: allowed")
+	}
+}
@@ -0,0 +1,206 @@
+package syntax
+
+import (
+	"encoding/json"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// minScore is the score that a language needs for Detect to pick it.
+const minScore = 3
+
+// A clue is a pattern which suggests that code is written in a language. Clues
+// that are specific to one language have a high weight, and those that are
+// shared by several languages a low one.
+type clue struct {
+	language string
+	weight   int
+	pattern  *regexp.Regexp
+}
+
+func newClue(language string, weight int, pattern string) clue {
+	return clue{language, weight, regexp.MustCompile(`(?m)` + pattern)}
+}
+
+// clues are the clues that Detect looks for. They only need to tell apart the
+// supported languages, not every language there is.
+var clues = []clue{
+	newClue("bash", 1, `^\s*echo\s`),
+	newClue("bash", 2, `^\s*(fi|done|esac)\s*$`),
+	newClue("bash", 2, `^\s*if \[\[? `),
+	newClue("bash", 1, `^\s*export [A-Z_]+=`),
+	newClue("bash", 1, `\$\{\w+\}`),
+
+	newClue("c", 2, `^#include\s*[<"][\w/]+\.h[>"]`),
+	newClue("c", 1, `\bint main\(`),
+	newClue("c", 2, `\b(printf|malloc|free)\(`),
+
+	newClue("cpp", 3, `^#include\s*<\w+>`),
+	newClue("cpp", 3, `\bstd::`),
+	newClue("cpp", 2, `\btemplate\s*<`),
+	newClue("cpp", 1, `\bint main\(`),
+
+	newClue("csharp", 3, `^using System`),
+	newClue("csharp", 3, `\bConsole\.Write(Line)?\(`),
+	newClue("csharp", 1, `^\s*namespace [\w.]+`),
+	newClue("csharp", 1, `\bpublic (static )?(class|void)\b`),
+
+	newClue("css", 2, `^\s*[.#]?[\w-]+(\s*[ ,>+~]\s*[.#]?[\w-]+)*(:[\w-]+)?\s*\{\s*$`),
+	newClue("css", 2, `^\s*(color|margin|padding|display|font-[\w-]+|background(-[\w-]+)?)\s*:\s*[^;]+;`),
+	newClue("css", 2, `@media\b`),
+
+	newClue("diff", 3, `^@@ -\d+(,\d+)? \+\d+(,\d+)? @@`),
+	newClue("diff", 2, `^(---|\+\+\+) \S`),
+
+	newClue("docker", 3, `^FROM \S+`),
+	newClue("docker", 2, `^(RUN|COPY|CMD|ENTRYPOINT|WORKDIR|EXPOSE|ENV) `),
+
+	newClue("go", 3, `^package \w+\s*$`),
+	newClue("go", 2, `\bfunc (\(\w+ \*?\w+\) )?\w+\(`),
+	newClue("go", 1, `:=`),
+	newClue("go", 2, `\b(fmt|errors|http)\.\w+\(`),
+	newClue("go", 2, `\bif err != nil\b`),
+
+	newClue("html", 3, `(?i)<!doctype html`),
+	newClue("html", 2, `(?i)<(html|head|body|div|span|p|a|ul|li|table|form)\b[^>]*>`),
+	newClue("html", 1, `</\w+>`),
+
+	newClue("java", 3, `\bSystem\.out\.print`),
+	newClue("java", 3, `^import java\.`),
+	newClue("java", 1, `\bpublic (static )?(class|void|final)\b`),
+	newClue("java", 2, `@Override\b`),
+
+	newClue("javascript", 2, `\b(const|let|var) \w+ =`),
+	newClue("javascript", 1, `=>`),
+	newClue("javascript", 3, `\bconsole\.log\(`),
+	newClue("javascript", 2, `\bfunction\s*\w*\s*\(`),
+	newClue("javascript", 2, `\brequire\(['"]`),
+	newClue("javascript", 2, `\b(document|window)\.\w+`),
+
+	newClue("kotlin", 3, `\bfun \w+\(`),
+	newClue("kotlin", 2, `\bval \w+`),
+
+	newClue("lua", 3, `\blocal (function )?\w+`),
+	newClue("lua", 1, `\bthen\s*$`),
+	newClue("lua", 1, `^\s*end\s*$`),
+
+	newClue("markdown", 2, `^#{1,6} \S`),
+	newClue("markdown", 2, "^```"),
+	newClue("markdown", 1, `\[[^\]]+\]\([^)]+\)`),
+	newClue("markdown", 1, `^\s*[-*] \S`),
+
+	newClue("php", 5, `<\?php`),
+	newClue("php", 1, `\$\w+\s*=`),
+
+	newClue("python", 3, `^\s*def \w+\(.*\)( -> [\w\[\], ]+)?:\s*$`),
+	newClue("python", 2, `^\s*(from [\w.]+ )?import \w+(, \w+)*\s*$`),
+	newClue("python", 2, `^\s*class \w+(\(.*\))?:\s*$`),
+	newClue("python", 2, `\bself\.`),
+	newClue("python", 1, `^\s*(if|elif|for|while) .*:\s*$`),
+	newClue("python", 1, `\bprint\(`),
+
+	newClue("ruby", 2, `^\s*def \w+[?!]?(\(.*\))?\s*$`),
+	newClue("ruby", 1, `^\s*end\s*$`),
+	newClue("ruby", 2, `^\s*puts\s`),
+	newClue("ruby", 2, `^\s*require ['"]`),
+	newClue("ruby", 2, `\.each (do|\{) \|`),
+
+	newClue("rust", 3, `\bfn \w+(<.*>)?\(`),
+	newClue("rust", 3, `\blet mut\b`),
+	newClue("rust", 3, `\b(println|vec|format)!\(`),
+	newClue("rust", 2, `^use \w+::`),
+	newClue("rust", 1, `\bimpl\b`),
+
+	newClue("sql", 3, `(?i)\bselect\b.+\bfrom\b`),
+	newClue("sql", 3, `(?i)^\s*(create|alter|drop) (table|index|view)\b`),
+	newClue("sql", 3, `(?i)^\s*insert into\b`),
+	newClue("sql", 1, `(?i)\bwhere\b`),
+
+	newClue("swift", 3, `^import (Foundation|UIKit|SwiftUI)\b`),
+	newClue("swift", 2, `\bfunc \w+\(.*\) -> \w+`),
+	newClue("swift", 1, `\bguard let\b`),
+
+	newClue("toml", 3, `^\[[\w.-]+\]\s*$`),
+	newClue("toml", 1, `^[\w-]+\s*=\s*("|\d|true|false|\[)`),
+
+	newClue("typescript", 3, `^\s*(export )?(interface|type) \w+`),
+	newClue("typescript", 2, `\b(const|let) \w+: \w+`),
+	newClue("typescript", 2, `\(\w+: (string|number|boolean|any)\b`),
+
+	newClue("yaml", 2, `^[\w-]+:(\s+\S.*)?$`),
+	newClue("yaml", 1, `^\s+- \S`),
+	newClue("yaml", 2, `^---\s*$`),
+}
+
+// interpreters maps the programs named in #! lines to languages.
+var interpreters = map[string]string{
+	"bash":    "bash",
+	"sh":      "bash",
+	"zsh":     "bash",
+	"node":    "javascript",
+	"php":     "php",
+	"python":  "python",
+	"python3": "python",
+	"ruby":    "ruby",
+}
+
+// Detect guesses which of the supported languages code is written in. It
+// returns the name of the language, or "" if it can't tell.
+func Detect(code string) string {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return ""
+	}
+
+	if language := detectShebang(code); language != "" {
+		return language
+	}
+
+	if (code[0] == '{' || code[0] == '[') && json.Valid([]byte(code)) {
+		return "json"
+	}
+
+	scores := make(map[string]int)
+	for _, c := range clues {
+		if c.pattern.MatchString(code) {
+			scores[c.language] += c.weight
+		}
+	}
+
+	// TypeScript is mostly JavaScript, so its clues only add to those
+	if scores["typescript"] > 0 {
+		scores["typescript"] += scores["javascript"]
+	}
+
+	// Pick the language with the highest score, in the order of Languages
+	// when there is a tie
+	best, bestScore := "", minScore-1
+	for _, l := range Languages {
+		if scores[l.Name] > bestScore {
+			best, bestScore = l.Name, scores[l.Name]
+		}
+	}
+	return best
+}
+
+// detectShebang returns the language of the interpreter named in the #! line
+// at the start of code, or "" if there isn't one.
+func detectShebang(code string) string {
+	line, _, _ := strings.Cut(code, "\n")
+	if !strings.HasPrefix(line, "#!") {
+		return ""
+	}
+
+	fields := strings.Fields(line[2:])
+	if len(fields) == 0 {
+		return ""
+	}
+
+	// #!/usr/bin/env python3 names the interpreter in its second field
+	program := path.Base(fields[0])
+	if program == "env" && len(fields) > 1 {
+		program = fields[1]
+	}
+	return interpreters[program]
+}
@@ -0,0 +1,125 @@
+// Package syntax highlights the source code of snippets, and guesses the
+// language that a snippet is written in when its author doesn't say.
+package syntax
+
+import (
+	"html/template"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// Language is a language that snippets can be highlighted as.
+type Language struct {
+	Name      string // stored with snippets and used in URLs, e.g. "cpp"
+	Title     string // shown to users, e.g. "C++"
+	Extension string // of the files that snippets are downloaded as, e.g. ".cpp"
+}
+
+// Languages are the supported languages, in the order they are offered to
+// users. Snippets without a language are highlighted as plain text. Every name
+// is also the name of a chroma lexer.
+var Languages = []Language{
+	{"bash", "Bash", ".sh"},
+	{"c", "C", ".c"},
+	{"cpp", "C++", ".cpp"},
+	{"csharp", "C#", ".cs"},
+	{"css", "CSS", ".css"},
+	{"diff", "Diff", ".diff"},
+	{"docker", "Dockerfile", ".dockerfile"},
+	{"go", "Go", ".go"},
+	{"html", "HTML", ".html"},
+	{"java", "Java", ".java"},
+	{"javascript", "JavaScript", ".js"},
+	{"json", "JSON", ".json"},
+	{"kotlin", "Kotlin", ".kt"},
+	{"lua", "Lua", ".lua"},
+	{"markdown", "Markdown", ".md"},
+	{"php", "PHP", ".php"},
+	{"python", "Python", ".py"},
+	{"ruby", "Ruby", ".rb"},
+	{"rust", "Rust", ".rs"},
+	{"sql", "SQL", ".sql"},
+	{"swift", "Swift", ".swift"},
+	{"toml", "TOML", ".toml"},
+	{"typescript", "TypeScript", ".ts"},
+	{"yaml", "YAML", ".yaml"},
+}
+
+// Names returns the names of the supported languages.
+func Names() []string {
+	names := make([]string, 0, len(Languages))
+	for _, l := range Languages {
+		names = append(names, l.Name)
+	}
+	return names
+}
+
+// Title returns the title of the language with the given name, or "Plain text"
+// if it is not supported.
+func Title(name string) string {
+	for _, l := range Languages {
+		if l.Name == name {
+			return l.Title
+		}
+	}
+	return "Plain text"
+}
+
+// Extension returns the file name extension of the language with the given
+// name, or ".txt" if it is not supported.
+func Extension(name string) string {
+	for _, l := range Languages {
+		if l.Name == name {
+			return l.Extension
+		}
+	}
+	return ".txt"
+}
+
+// formatter writes the highlighted code as HTML with CSS classes rather than
+// inline styles, which the Content-Security-Policy header doesn't allow. The
+// classes are styled by ui/static/css/highlight.css. Every line is numbered,
+// and the numbers link to themselves, e.g. #L12 for the 12th line.
+var formatter = html.New(
+	html.WithClasses(true),
+	html.WithLineNumbers(true),
+	html.WithLinkableLineNumbers(true, "L"),
+	html.TabWidth(4),
+)
+
+// style is the chroma style that highlight.css was generated from. The
+// formatter only needs it for the background of the <pre> element.
+var style = styles.Get("github")
+
+// Highlight returns code as a <pre> element, highlighted as the language with
+// the given name. Code in unsupported languages is escaped and has its lines
+// numbered, but is otherwise left as it is.
+func Highlight(code, language string) (template.HTML, error) {
+	lexer := lexers.Get(language)
+	if language == "" || lexer == nil {
+		lexer = lexers.Fallback
+	}
+	// Merge runs of tokens of the same type, to make the HTML smaller
+	lexer = chroma.Coalesce(lexer)
+
+	// Lines are split at \n, so the \r of Windows line endings would be left
+	// at the end of every line
+	code = strings.ReplaceAll(code, "\r\n", "\n")
+
+	iterator, err := lexer.Tokenise(nil, code)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	err = formatter.Format(&b, style, iterator)
+	if err != nil {
+		return "", err
+	}
+
+	return template.HTML(b.String()), nil
+}
@@ -0,0 +1,109 @@
+// Package totp implements the time-based one-time passwords of RFC 6238, with
+// the parameters that authenticator apps use by default: HMAC-SHA1, 6 digits
+// and a new code every 30 seconds.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Digits is the number of digits of a code.
+	Digits = 6
+	// Period is how long each code is valid for.
+	Period = 30 * time.Second
+	// Skew is how many periods before and after the current one Validate also
+	// accepts codes from, to allow for clocks that are a little off and users
+	// who are a little slow.
+	Skew = 1
+)
+
+// modulus keeps the last Digits digits of a number.
+const modulus = 1_000_000
+
+// encoding is the base32 encoding of secrets, without padding, as
+// authenticator apps expect.
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new random 160-bit secret, base32-encoded, which is
+// the length that RFC 4226 recommends for HMAC-SHA1.
+func GenerateSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+// Step returns the number of the period that t falls in, counting from the
+// Unix epoch.
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+// Code returns the code of secret for the period with the given step.
+func Code(secret string, step int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("totp: invalid secret: %w", err)
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	h := hmac.New(sha1.New, key)
+	h.Write(msg[:])
+	sum := h.Sum(nil)
+
+	// Dynamic truncation, see RFC 4226 section 5.3
+	offset := sum[len(sum)-1] & 0x0f
+	n := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", Digits, n%modulus), nil
+}
+
+// Validate checks code against the codes of secret at time t, give or take
+// Skew periods. If it matches one, Validate returns its step, so that callers
+// can refuse to accept the same code again.
+func Validate(secret, code string, t time.Time) (int64, bool) {
+	if len(code) != Digits {
+		return 0, false
+	}
+
+	now := Step(t)
+	for step := now - Skew; step <= now+Skew; step++ {
+		want, err := Code(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(want), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// URI returns the otpauth:// URI of secret, which authenticator apps read from
+// QR codes. The issuer and account name the secret in the app, e.g.
+// "Snippetbox" and "alice@example.com". See
+// https://github.com/google/google-authenticator/wiki/Key-Uri-Format
+func URI(secret, issuer, account string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", strconv.Itoa(Digits))
+	v.Set("period", strconv.Itoa(int(Period/time.Second)))
+
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+account) + "?" + v.Encode()
+}
@@ -0,0 +1,86 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 secret of the test vectors in RFC 6238 Appendix B,
+// "12345678901234567890", base32-encoded.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// The RFC's codes have 8 digits, of which the last 6 are the codes with
+	// Digits digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("at %d: got %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestCodeInvalidSecret(t *testing.T) {
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("got no error")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step := Step(now)
+
+	for offset := int64(-Skew - 1); offset <= Skew+1; offset++ {
+		code, err := Code(rfcSecret, step+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, ok := Validate(rfcSecret, code, now)
+		wantOK := offset >= -Skew && offset <= Skew
+		if ok != wantOK {
+			t.Errorf("code of step %+d: got %t, want %t", offset, ok, wantOK)
+		}
+		if ok && got != step+offset {
+			t.Errorf("code of step %+d: got step %d, want %d", offset, got, step+offset)
+		}
+	}
+}
+
+func TestValidateMalformed(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+
+	for _, code := range []string{"", "05924", "0059240", "abcdef"} {
+		if _, ok := Validate(rfcSecret, code, now); ok {
+			t.Errorf("%q: accepted", code)
+		}
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) != 32 {
+		t.Errorf("got %d characters, want 32", len(secret))
+	}
+	if _, err := Code(secret, 1); err != nil {
+		t.Errorf("secret can't be used: %s", err)
+	}
+}
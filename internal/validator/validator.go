@@ -9,6 +9,10 @@ import (
 
 var EmailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`)
 
+// TagRegex matches the names that tags can have: lowercase letters and digits,
+// followed by "+", "-" or "." too, e.g. "c++" or "node.js".
+var TagRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9+.\-]*$`)
+
 // Validator is a struct for implementing validation logic and holding validation error strings.
 type Validator struct {
 	NonFieldErrors []string          // validation errors not related to a specific form field e.g. login failure
@@ -76,3 +80,38 @@ func PermittedInt(value int, permittedValues ...int) bool {
 func Matches(value string, rx *regexp.Regexp) bool {
 	return rx.MatchString(value)
 }
+
+// PermittedString returns true if value is within the slice of permittedValues.
+func PermittedString(value string, permittedValues ...string) bool {
+	for i := range permittedValues {
+		if value == permittedValues[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// MaxItems returns true if values contains at most n items.
+func MaxItems(values []string, n int) bool {
+	return len(values) <= n
+}
+
+// AllMaxChars returns true if every one of values contains at most n characters.
+func AllMaxChars(values []string, n int) bool {
+	for _, value := range values {
+		if !MaxChars(value, n) {
+			return false
+		}
+	}
+	return true
+}
+
+// AllMatch returns true if every one of values matches the provided regex rx.
+func AllMatch(values []string, rx *regexp.Regexp) bool {
+	for _, value := range values {
+		if !Matches(value, rx) {
+			return false
+		}
+	}
+	return true
+}
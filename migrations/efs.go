@@ -0,0 +1,12 @@
+package migrations
+
+import (
+	"embed"
+)
+
+// Files holds the versioned schema migrations of each SQL storage backend, in
+// the "mysql" and "sqlite" subdirectories. Every migration is a pair of files
+// named <version>_<name>.up.sql and <version>_<name>.down.sql.
+//
+//go:embed "mysql" "sqlite"
+var Files embed.FS
@@ -0,0 +1,3 @@
+-- Snippets created before this column existed have no owner, so it is nullable
+ALTER TABLE snippets ADD COLUMN user_id INTEGER NULL;
+ALTER TABLE snippets ADD CONSTRAINT fk_snippets_user_id FOREIGN KEY (user_id) REFERENCES users(id);
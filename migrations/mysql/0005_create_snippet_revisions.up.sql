@@ -0,0 +1,16 @@
+CREATE TABLE snippet_revisions (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    snippet_id INTEGER NOT NULL,
+    version INTEGER NOT NULL,
+    user_id INTEGER NULL,
+    title VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    created DATETIME NOT NULL,
+    CONSTRAINT snippet_revisions_uc_version UNIQUE (snippet_id, version),
+    CONSTRAINT fk_snippet_revisions_snippet_id FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE,
+    CONSTRAINT fk_snippet_revisions_user_id FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- Record the current state of existing snippets as their first revision
+INSERT INTO snippet_revisions (snippet_id, version, user_id, title, content, created)
+SELECT id, 1, user_id, title, content, created FROM snippets;
@@ -0,0 +1,10 @@
+-- Expired snippets are moved here by the purge job when archiving is enabled
+CREATE TABLE snippets_archive (
+    id INTEGER NOT NULL PRIMARY KEY,
+    user_id INTEGER NULL,
+    title VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    created DATETIME NOT NULL,
+    expires DATETIME NOT NULL,
+    archived DATETIME NOT NULL
+);
@@ -0,0 +1,2 @@
+-- Used by SnippetModel.Search
+ALTER TABLE snippets ADD FULLTEXT INDEX idx_snippets_fulltext (title, content);
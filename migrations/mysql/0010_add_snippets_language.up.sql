@@ -0,0 +1,5 @@
+-- Existing snippets are shown as plain text, which an empty language stands for
+ALTER TABLE snippets ADD COLUMN language VARCHAR(30) NOT NULL DEFAULT '';
+
+-- Used to list the snippets in a language
+CREATE INDEX idx_snippets_language ON snippets(language);
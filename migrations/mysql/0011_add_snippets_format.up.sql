@@ -0,0 +1,2 @@
+-- Existing snippets are highlighted as code
+ALTER TABLE snippets ADD COLUMN format VARCHAR(10) NOT NULL DEFAULT 'code';
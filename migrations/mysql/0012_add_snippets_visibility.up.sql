@@ -0,0 +1,5 @@
+-- Existing snippets stay public. Only unlisted snippets have a slug, which is
+-- compared case-sensitively.
+ALTER TABLE snippets ADD COLUMN visibility VARCHAR(10) NOT NULL DEFAULT 'public';
+ALTER TABLE snippets ADD COLUMN slug VARCHAR(32) CHARACTER SET ascii COLLATE ascii_bin NULL;
+CREATE UNIQUE INDEX idx_snippets_slug ON snippets(slug);
@@ -0,0 +1,8 @@
+-- Existing snippets are given random public IDs which, like those of new
+-- snippets, start with a letter. They are marked as legacy, so that their old
+-- integer URLs redirect to the new ones.
+ALTER TABLE snippets ADD COLUMN public_id VARCHAR(16) CHARACTER SET ascii COLLATE ascii_bin NULL;
+ALTER TABLE snippets ADD COLUMN legacy BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE snippets SET public_id = CONCAT(CHAR(97 + FLOOR(RAND() * 26) USING ascii), LOWER(HEX(RANDOM_BYTES(7)))), legacy = TRUE;
+ALTER TABLE snippets MODIFY public_id VARCHAR(16) CHARACTER SET ascii COLLATE ascii_bin NOT NULL;
+CREATE UNIQUE INDEX idx_snippets_public_id ON snippets(public_id);
@@ -0,0 +1,4 @@
+-- Burned snippets are kept, without their content, until they expire, so that
+-- their URLs can tell viewers that they are gone
+ALTER TABLE snippets ADD COLUMN burn_after_reading BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE snippets ADD COLUMN burned BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,2 @@
+-- Only the bcrypt hash of a snippet's password is stored, like those of users
+ALTER TABLE snippets ADD COLUMN password_hash CHAR(60) NULL;
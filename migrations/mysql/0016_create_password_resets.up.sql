@@ -0,0 +1,10 @@
+-- Like API tokens, reset tokens are stored as their SHA-256 hash
+CREATE TABLE password_resets (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    hash CHAR(64) NOT NULL,
+    created DATETIME NOT NULL,
+    expires DATETIME NOT NULL,
+    CONSTRAINT password_resets_uc_hash UNIQUE (hash),
+    CONSTRAINT fk_password_resets_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
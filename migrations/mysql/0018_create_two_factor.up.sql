@@ -0,0 +1,19 @@
+-- Unlike passwords, TOTP secrets can't be hashed, as the codes are computed
+-- from them. last_step is the time step of the last code that was used, so
+-- that no code can be used twice.
+CREATE TABLE two_factor (
+    user_id INTEGER NOT NULL PRIMARY KEY,
+    secret VARCHAR(64) NOT NULL,
+    last_step BIGINT NOT NULL DEFAULT 0,
+    created DATETIME NOT NULL,
+    CONSTRAINT fk_two_factor_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Like API tokens, recovery codes are stored as their SHA-256 hash
+CREATE TABLE recovery_codes (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    hash CHAR(64) NOT NULL,
+    CONSTRAINT recovery_codes_uc_hash UNIQUE (user_id, hash),
+    CONSTRAINT fk_recovery_codes_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,17 @@
+-- Credential IDs are chosen by the authenticator and can be up to 1023 bytes
+-- long. They must be unique across all users, as logging in with a passkey
+-- looks the user up by it.
+CREATE TABLE passkeys (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    credential_id VARBINARY(1023) NOT NULL,
+    public_key BLOB NOT NULL,
+    sign_count INTEGER UNSIGNED NOT NULL DEFAULT 0,
+    backup_eligible BOOLEAN NOT NULL DEFAULT FALSE,
+    transports VARCHAR(255) NOT NULL DEFAULT '',
+    created DATETIME NOT NULL,
+    last_used DATETIME NULL,
+    CONSTRAINT passkeys_uc_credential_id UNIQUE (credential_id),
+    CONSTRAINT fk_passkeys_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,74 @@
+-- Migration 0013 gave existing snippets public IDs of 15 hex characters, unlike
+-- the 10 base62 ones of new snippets. They are given new ones here, checked
+-- against every other public ID, as a collision would break the unique index.
+-- Snippets whose new ID collides anyway are tried again, up to three times, and
+-- otherwise keep their old ID, which goes on working.
+CREATE TEMPORARY TABLE new_public_ids (
+    id INTEGER NOT NULL PRIMARY KEY,
+    public_id VARCHAR(16) CHARACTER SET ascii COLLATE ascii_bin NOT NULL UNIQUE
+);
+
+INSERT IGNORE INTO new_public_ids (id, public_id)
+    SELECT id, CONCAT(
+        SUBSTRING('ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + CONV(HEX(RANDOM_BYTES(4)), 16, 10) % 52, 1),
+        SUBSTRING('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + CONV(HEX(RANDOM_BYTES(4)), 16, 10) % 62, 1),
+        SUBSTRING('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + CONV(HEX(RANDOM_BYTES(4)), 16, 10) % 62, 1),
+        SUBSTRING('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + CONV(HEX(RANDOM_BYTES(4)), 16, 10) % 62, 1),
+        SUBSTRING('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + CONV(HEX(RANDOM_BYTES(4)), 16, 10) % 62, 1),
+        SUBSTRING('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + CONV(HEX(RANDOM_BYTES(4)), 16, 10) % 62, 1),
+        SUBSTRING('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + CONV(HEX(RANDOM_BYTES(4)), 16, 10) % 62, 1),
+        SUBSTRING('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + CONV(HEX(RANDOM_BYTES(4)), 16, 10) % 62, 1),
+        SUBSTRING('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + CONV(HEX(RANDOM_BYTES(4)), 16, 10) % 62, 1),
+        SUBSTRING('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + CONV(HEX(RANDOM_BYTES(4)), 16, 10) % 62, 1)
+    )
+    FROM snippets WHERE legacy AND CHAR_LENGTH(public_id) <> 10;
+UPDATE snippets s
+    JOIN new_public_ids n ON n.id = s.id
+    LEFT JOIN snippets taken ON taken.public_id = n.public_id
+    SET s.public_id = n.public_id
+    WHERE taken.id IS NULL;
+DELETE FROM new_public_ids;
+
+INSERT IGNORE INTO new_public_ids (id, public_id)
+    SELECT id, CONCAT(
+        SUBSTRING('ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + CONV(HEX(RANDOM_BYTES(4)), 16, 10) % 52, 1),
+        SUBSTRING('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + CONV(HEX(RANDOM_BYTES(4)), 16, 10) % 62, 1),
+        SUBSTRING('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + CONV(HEX(RANDOM_BYTES(4)), 16, 10) % 62, 1),
+        SUBSTRING('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + CONV(HEX(RANDOM_BYTES(4)), 16, 10) % 62, 1),
+        SUBSTRING('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + CONV(HEX(RANDOM_BYTES(4)), 16, 10) % 62, 1),
+        SUBSTRING('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + CONV(HEX(RANDOM_BYTES(4)), 16, 10) % 62, 1),
+        SUBSTRING('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + CONV(HEX(RANDOM_BYTES(4)), 16, 10) % 62, 1),
+        SUBSTRING('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + CONV(HEX(RANDOM_BYTES(4)), 16, 10) % 62, 1),
+        SUBSTRING('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + CONV(HEX(RANDOM_BYTES(4)), 16, 10) % 62, 1),
+        SUBSTRING('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + CONV(HEX(RANDOM_BYTES(4)), 16, 10) % 62, 1)
+    )
+    FROM snippets WHERE legacy AND CHAR_LENGTH(public_id) <> 10;
+UPDATE snippets s
+    JOIN new_public_ids n ON n.id = s.id
+    LEFT JOIN snippets taken ON taken.public_id = n.public_id
+    SET s.public_id = n.public_id
+    WHERE taken.id IS NULL;
+DELETE FROM new_public_ids;
+
+INSERT IGNORE INTO new_public_ids (id, public_id)
+    SELECT id, CONCAT(
+        SUBSTRING('ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + CONV(HEX(RANDOM_BYTES(4)), 16, 10) % 52, 1),
+        SUBSTRING('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + CONV(HEX(RANDOM_BYTES(4)), 16, 10) % 62, 1),
+        SUBSTRING('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + CONV(HEX(RANDOM_BYTES(4)), 16, 10) % 62, 1),
+        SUBSTRING('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + CONV(HEX(RANDOM_BYTES(4)), 16, 10) % 62, 1),
+        SUBSTRING('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + CONV(HEX(RANDOM_BYTES(4)), 16, 10) % 62, 1),
+        SUBSTRING('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + CONV(HEX(RANDOM_BYTES(4)), 16, 10) % 62, 1),
+        SUBSTRING('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + CONV(HEX(RANDOM_BYTES(4)), 16, 10) % 62, 1),
+        SUBSTRING('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + CONV(HEX(RANDOM_BYTES(4)), 16, 10) % 62, 1),
+        SUBSTRING('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + CONV(HEX(RANDOM_BYTES(4)), 16, 10) % 62, 1),
+        SUBSTRING('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + CONV(HEX(RANDOM_BYTES(4)), 16, 10) % 62, 1)
+    )
+    FROM snippets WHERE legacy AND CHAR_LENGTH(public_id) <> 10;
+UPDATE snippets s
+    JOIN new_public_ids n ON n.id = s.id
+    LEFT JOIN snippets taken ON taken.public_id = n.public_id
+    SET s.public_id = n.public_id
+    WHERE taken.id IS NULL;
+DELETE FROM new_public_ids;
+
+DROP TEMPORARY TABLE new_public_ids;
@@ -0,0 +1,10 @@
+-- The archive keeps everything needed to restore a snippet but its revisions,
+-- with its tags as a comma-separated list. Snippets archived before have NULL
+-- in these columns, as their values weren't kept.
+ALTER TABLE snippets_archive ADD COLUMN public_id VARCHAR(16) CHARACTER SET ascii COLLATE ascii_bin NULL;
+ALTER TABLE snippets_archive ADD COLUMN format VARCHAR(10) NULL;
+ALTER TABLE snippets_archive ADD COLUMN language VARCHAR(30) NULL;
+ALTER TABLE snippets_archive ADD COLUMN visibility VARCHAR(10) NULL;
+ALTER TABLE snippets_archive ADD COLUMN slug VARCHAR(32) CHARACTER SET ascii COLLATE ascii_bin NULL;
+ALTER TABLE snippets_archive ADD COLUMN password_hash CHAR(60) NULL;
+ALTER TABLE snippets_archive ADD COLUMN tags TEXT NULL;
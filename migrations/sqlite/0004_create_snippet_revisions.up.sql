@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS snippet_revisions (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    user_id INTEGER NULL REFERENCES users(id),
+    title VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    created DATETIME NOT NULL,
+    CONSTRAINT snippet_revisions_uc_version UNIQUE (snippet_id, version)
+);
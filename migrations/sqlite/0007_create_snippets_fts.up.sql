@@ -0,0 +1,24 @@
+-- Full-text index of snippets, used by SnippetModel.Search. The triggers keep
+-- it in step with the snippets table, which holds the indexed text.
+CREATE VIRTUAL TABLE IF NOT EXISTS snippets_fts USING fts5(
+    title,
+    content,
+    content = 'snippets',
+    content_rowid = 'id'
+);
+
+CREATE TRIGGER IF NOT EXISTS snippets_fts_insert AFTER INSERT ON snippets BEGIN
+    INSERT INTO snippets_fts (rowid, title, content) VALUES (new.id, new.title, new.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS snippets_fts_delete AFTER DELETE ON snippets BEGIN
+    INSERT INTO snippets_fts (snippets_fts, rowid, title, content) VALUES ('delete', old.id, old.title, old.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS snippets_fts_update AFTER UPDATE ON snippets BEGIN
+    INSERT INTO snippets_fts (snippets_fts, rowid, title, content) VALUES ('delete', old.id, old.title, old.content);
+    INSERT INTO snippets_fts (rowid, title, content) VALUES (new.id, new.title, new.content);
+END;
+
+-- Index the snippets created before this migration
+INSERT INTO snippets_fts (snippets_fts) VALUES ('rebuild');
@@ -0,0 +1,2 @@
+DROP INDEX idx_snippets_language;
+ALTER TABLE snippets DROP COLUMN language;
@@ -0,0 +1,4 @@
+-- Existing snippets stay public. Only unlisted snippets have a slug.
+ALTER TABLE snippets ADD COLUMN visibility VARCHAR(10) NOT NULL DEFAULT 'public';
+ALTER TABLE snippets ADD COLUMN slug VARCHAR(32) NULL;
+CREATE UNIQUE INDEX idx_snippets_slug ON snippets(slug);
@@ -0,0 +1,3 @@
+DROP INDEX idx_snippets_public_id;
+ALTER TABLE snippets DROP COLUMN legacy;
+ALTER TABLE snippets DROP COLUMN public_id;
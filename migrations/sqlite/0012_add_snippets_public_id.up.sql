@@ -0,0 +1,7 @@
+-- Existing snippets are given random public IDs which, like those of new
+-- snippets, start with a letter. They are marked as legacy, so that their old
+-- integer URLs redirect to the new ones.
+ALTER TABLE snippets ADD COLUMN public_id VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE snippets ADD COLUMN legacy BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE snippets SET public_id = char(97 + abs(random()) % 26) || lower(hex(randomblob(7))), legacy = TRUE;
+CREATE UNIQUE INDEX idx_snippets_public_id ON snippets(public_id);
@@ -0,0 +1,9 @@
+-- Like API tokens, reset tokens are stored as their SHA-256 hash
+CREATE TABLE IF NOT EXISTS password_resets (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    hash CHAR(64) NOT NULL,
+    created DATETIME NOT NULL,
+    expires DATETIME NOT NULL,
+    CONSTRAINT password_resets_uc_hash UNIQUE (hash)
+);
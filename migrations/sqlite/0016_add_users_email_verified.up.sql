@@ -0,0 +1,4 @@
+-- Users who signed up before email addresses were verified are trusted, so
+-- that they can go on creating snippets
+ALTER TABLE users ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE users SET email_verified = TRUE;
@@ -0,0 +1,17 @@
+-- Unlike passwords, TOTP secrets can't be hashed, as the codes are computed
+-- from them. last_step is the time step of the last code that was used, so
+-- that no code can be used twice.
+CREATE TABLE IF NOT EXISTS two_factor (
+    user_id INTEGER NOT NULL PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret VARCHAR(64) NOT NULL,
+    last_step BIGINT NOT NULL DEFAULT 0,
+    created DATETIME NOT NULL
+);
+
+-- Like API tokens, recovery codes are stored as their SHA-256 hash
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    hash CHAR(64) NOT NULL,
+    CONSTRAINT recovery_codes_uc_hash UNIQUE (user_id, hash)
+);
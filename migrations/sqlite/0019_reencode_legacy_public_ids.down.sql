@@ -0,0 +1,2 @@
+-- The old public IDs are gone, and the new ones work just as well, so there is
+-- nothing to revert.
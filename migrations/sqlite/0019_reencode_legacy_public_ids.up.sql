@@ -0,0 +1,74 @@
+-- Migration 0012 gave existing snippets public IDs of 15 hex characters, unlike
+-- the 10 base62 ones of new snippets. They are given new ones here, checked
+-- against every other public ID, as a collision would break the unique index.
+-- Snippets whose new ID collides anyway are tried again, up to three times, and
+-- otherwise keep their old ID, which goes on working.
+CREATE TEMP TABLE new_public_ids (
+    id INTEGER NOT NULL PRIMARY KEY,
+    public_id VARCHAR(16) NOT NULL UNIQUE
+);
+
+INSERT OR IGNORE INTO new_public_ids (id, public_id)
+    SELECT id,
+        substr('ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + abs(random() % 52), 1) ||
+        substr('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + abs(random() % 62), 1) ||
+        substr('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + abs(random() % 62), 1) ||
+        substr('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + abs(random() % 62), 1) ||
+        substr('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + abs(random() % 62), 1) ||
+        substr('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + abs(random() % 62), 1) ||
+        substr('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + abs(random() % 62), 1) ||
+        substr('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + abs(random() % 62), 1) ||
+        substr('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + abs(random() % 62), 1) ||
+        substr('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + abs(random() % 62), 1)
+    FROM snippets WHERE legacy AND length(public_id) <> 10;
+UPDATE snippets
+    SET public_id = (SELECT n.public_id FROM new_public_ids n WHERE n.id = snippets.id)
+    WHERE id IN (
+        SELECT n.id FROM new_public_ids n
+        WHERE NOT EXISTS (SELECT 1 FROM snippets s WHERE s.public_id = n.public_id)
+    );
+DELETE FROM new_public_ids;
+
+INSERT OR IGNORE INTO new_public_ids (id, public_id)
+    SELECT id,
+        substr('ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + abs(random() % 52), 1) ||
+        substr('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + abs(random() % 62), 1) ||
+        substr('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + abs(random() % 62), 1) ||
+        substr('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + abs(random() % 62), 1) ||
+        substr('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + abs(random() % 62), 1) ||
+        substr('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + abs(random() % 62), 1) ||
+        substr('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + abs(random() % 62), 1) ||
+        substr('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + abs(random() % 62), 1) ||
+        substr('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + abs(random() % 62), 1) ||
+        substr('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + abs(random() % 62), 1)
+    FROM snippets WHERE legacy AND length(public_id) <> 10;
+UPDATE snippets
+    SET public_id = (SELECT n.public_id FROM new_public_ids n WHERE n.id = snippets.id)
+    WHERE id IN (
+        SELECT n.id FROM new_public_ids n
+        WHERE NOT EXISTS (SELECT 1 FROM snippets s WHERE s.public_id = n.public_id)
+    );
+DELETE FROM new_public_ids;
+
+INSERT OR IGNORE INTO new_public_ids (id, public_id)
+    SELECT id,
+        substr('ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + abs(random() % 52), 1) ||
+        substr('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + abs(random() % 62), 1) ||
+        substr('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + abs(random() % 62), 1) ||
+        substr('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + abs(random() % 62), 1) ||
+        substr('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + abs(random() % 62), 1) ||
+        substr('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + abs(random() % 62), 1) ||
+        substr('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + abs(random() % 62), 1) ||
+        substr('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + abs(random() % 62), 1) ||
+        substr('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + abs(random() % 62), 1) ||
+        substr('0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz', 1 + abs(random() % 62), 1)
+    FROM snippets WHERE legacy AND length(public_id) <> 10;
+UPDATE snippets
+    SET public_id = (SELECT n.public_id FROM new_public_ids n WHERE n.id = snippets.id)
+    WHERE id IN (
+        SELECT n.id FROM new_public_ids n
+        WHERE NOT EXISTS (SELECT 1 FROM snippets s WHERE s.public_id = n.public_id)
+    );
+DELETE FROM new_public_ids;
+
+DROP TABLE new_public_ids;
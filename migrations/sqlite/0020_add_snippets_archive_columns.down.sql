@@ -0,0 +1,7 @@
+ALTER TABLE snippets_archive DROP COLUMN tags;
+ALTER TABLE snippets_archive DROP COLUMN password_hash;
+ALTER TABLE snippets_archive DROP COLUMN slug;
+ALTER TABLE snippets_archive DROP COLUMN visibility;
+ALTER TABLE snippets_archive DROP COLUMN language;
+ALTER TABLE snippets_archive DROP COLUMN format;
+ALTER TABLE snippets_archive DROP COLUMN public_id;
@@ -0,0 +1,139 @@
+// Passkeys are added and used with the WebAuthn API of the browser. The server
+// sends the options of each ceremony as JSON, with binary values such as the
+// challenge in base64url, and expects the authenticator's response the same
+// way. The forms stay hidden in browsers without passkeys.
+(function () {
+	if (!window.PublicKeyCredential || !window.fetch) {
+		return;
+	}
+
+	function toBytes(s) {
+		var b = atob(s.replace(/-/g, "+").replace(/_/g, "/"));
+		var bytes = new Uint8Array(b.length);
+		for (var i = 0; i < b.length; i++) {
+			bytes[i] = b.charCodeAt(i);
+		}
+		return bytes.buffer;
+	}
+
+	function toBase64URL(buffer) {
+		var bytes = new Uint8Array(buffer);
+		var b = "";
+		for (var i = 0; i < bytes.length; i++) {
+			b += String.fromCharCode(bytes[i]);
+		}
+		return btoa(b).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+	}
+
+	// post sends body as JSON to url, and resolves with the JSON response, or
+	// rejects with the error message of the server
+	function post(form, url, body) {
+		return fetch(url, {
+			method: "POST",
+			credentials: "same-origin",
+			headers: {
+				"Content-Type": "application/json",
+				"X-CSRF-Token": form.elements.csrf_token.value
+			},
+			body: JSON.stringify(body || {})
+		}).then(function (res) {
+			return res.json().catch(function () {
+				return {error: "Something went wrong. Please try again."};
+			}).then(function (data) {
+				if (!res.ok) {
+					var fieldErrors = data.field_errors || {};
+					throw new Error(fieldErrors.name || data.error);
+				}
+				return data;
+			});
+		});
+	}
+
+	function showError(form, message) {
+		var error = form.querySelector("div.error");
+		if (!error) {
+			error = document.createElement("div");
+			error.className = "error";
+			form.insertBefore(error, form.firstChild);
+		}
+		error.textContent = message;
+	}
+
+	// credentialJSON returns the parts of a PublicKeyCredential that the server
+	// needs
+	function credentialJSON(credential) {
+		var response = {
+			clientDataJSON: toBase64URL(credential.response.clientDataJSON)
+		};
+		if (credential.response.attestationObject) {
+			response.attestationObject = toBase64URL(credential.response.attestationObject);
+			response.transports = credential.response.getTransports ? credential.response.getTransports() : [];
+		} else {
+			response.authenticatorData = toBase64URL(credential.response.authenticatorData);
+			response.signature = toBase64URL(credential.response.signature);
+			if (credential.response.userHandle) {
+				response.userHandle = toBase64URL(credential.response.userHandle);
+			}
+		}
+
+		return {
+			id: credential.id,
+			rawId: toBase64URL(credential.rawId),
+			type: credential.type,
+			authenticatorAttachment: credential.authenticatorAttachment || undefined,
+			response: response
+		};
+	}
+
+	function start(form, ceremony) {
+		form.hidden = false;
+		form.addEventListener("submit", function (e) {
+			e.preventDefault();
+			ceremony(form).then(function (data) {
+				window.location = data.redirect;
+			}).catch(function (err) {
+				// The user closed the browser's dialog
+				if (err.name === "NotAllowedError" || err.name === "AbortError") {
+					return;
+				}
+				showError(form, err.message);
+			});
+		});
+	}
+
+	var add = document.getElementById("passkey-add");
+	if (add) {
+		start(add, function (form) {
+			return post(form, form.action).then(function (options) {
+				var publicKey = options.publicKey;
+				publicKey.challenge = toBytes(publicKey.challenge);
+				publicKey.user.id = toBytes(publicKey.user.id);
+				(publicKey.excludeCredentials || []).forEach(function (c) {
+					c.id = toBytes(c.id);
+				});
+				return navigator.credentials.create({publicKey: publicKey});
+			}).then(function (credential) {
+				return post(form, form.dataset.finish, {
+					name: form.elements.name.value,
+					credential: credentialJSON(credential)
+				});
+			});
+		});
+	}
+
+	var login = document.getElementById("passkey-login");
+	if (login) {
+		start(login, function (form) {
+			return post(form, form.action).then(function (options) {
+				var publicKey = options.publicKey;
+				publicKey.challenge = toBytes(publicKey.challenge);
+				(publicKey.allowCredentials || []).forEach(function (c) {
+					c.id = toBytes(c.id);
+				});
+				return navigator.credentials.get({publicKey: publicKey});
+			}).then(function (credential) {
+				return post(form, form.dataset.finish, credentialJSON(credential));
+			});
+		});
+	}
+})();